@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// An adjacencyReporter records the adjacency list of the link graph for --output=adjacency, and writes it to the file
+// at path when the crawl is finished: every crawled page, mapped to the canonical URLs it links to, in the order they
+// appear on the page and without duplicates. Only the links in the scope of the crawl are kept, so with --same_host
+// or --same-domain the graph stays on the site.
+type adjacencyReporter struct {
+	path string
+	adj  map[string][]string
+}
+
+func newAdjacencyReporter(path string) *adjacencyReporter {
+	return &adjacencyReporter{path, map[string][]string{}}
+}
+
+func (a *adjacencyReporter) Page(url string, r *result) {
+	children := []string{}
+	seen := map[string]bool{}
+	for _, l := range r.links {
+		target := normalizeURL(l.url)
+		if seen[target] || scopeRule(target) != "" {
+			continue
+		}
+		seen[target] = true
+		children = append(children, target)
+	}
+	a.adj[url] = children
+}
+
+// Write the adjacency list as a JSON object, which graph libraries like NetworkX (nx.from_dict_of_lists) and igraph
+// can read directly
+func (a *adjacencyReporter) Finish(Stats, map[string]int) error {
+	b, err := json.MarshalIndent(a.adj, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(a.path, append(b, '\n'), 0666)
+}
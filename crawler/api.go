@@ -0,0 +1,445 @@
+package crawler
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config is the configuration of a Crawler. The zero value of a field means the default of the command line tool.
+type Config struct {
+	// Depth is the number of links to follow from the start URL, where 1 only crawls the start URL (default 2)
+	Depth int
+
+	// MaxURLs is the maximal number of URLs to crawl, including the start URL (default 150)
+	MaxURLs int
+
+	// Concurrency is the maximal number of pages to fetch at the same time (default 20)
+	Concurrency int
+
+	// MaxPerHost is the maximal number of pages of one host to fetch at the same time, and Delay the minimal time
+	// between the requests to one host, like --max-per-host and --delay (default no limit). They apply to a custom
+	// Fetcher as well.
+	MaxPerHost int
+	Delay      time.Duration
+
+	// Timeout is the maximal time to fetch a page, including reading its body (default 10s)
+	Timeout time.Duration
+
+	// UserAgent is sent with every request, and robots.txt rules are matched with it (default gocrawler)
+	UserAgent string
+
+	// Headers are sent with every request to the host of the start URL, like --header
+	Headers map[string]string
+
+	// Proxy is the URL of the proxy to send the requests through, like --proxy (default from the environment),
+	// and Insecure skips verifying TLS certificates, like --insecure
+	Proxy    string
+	Insecure bool
+
+	// Cookies keeps the cookies that servers set and sends them back, like --cookies
+	Cookies bool
+
+	// Client makes the requests when it is set, with its own transport, cookie jar and redirect policy, instead of a
+	// client set up from the options. The requests still get the UserAgent and Headers, but its redirect policy
+	// decides which headers follow a redirect. Sharing one Client between Crawlers also shares its connections and
+	// cookies.
+	Client *http.Client
+
+	// SameHost only follows links to the host of the start URL, like --same_host,
+	// and with IncludeSubdomains also to the hosts under it, like --include-subdomains
+	SameHost          bool
+	IncludeSubdomains bool
+
+	// SameDomain only follows links to the registrable domain of the start URL, like --same-domain
+	SameDomain bool
+
+	// Allow and Deny are regular expressions for the URLs to follow, and for those not to follow, like --allow
+	// and --deny
+	Allow string
+	Deny  string
+
+	// Fetcher fetches the pages. When it is nil, they are fetched over HTTP and the Result has the crawled pages.
+	Fetcher Fetcher
+
+	// Score orders the URLs of every depth, so that the ones with the highest score are crawled first, and get the
+	// max_urls slots when there are not enough for all of them (default by inverse depth)
+	Score Score
+
+	// Reporters get every page as soon as it is crawled, and the statistics when the crawl is finished. They only
+	// get the pages of the built-in fetcher, not those of a custom Fetcher.
+	Reporters []Reporter
+
+	// Options sets any other command line option by its name without the dashes, e.g. {"extract-images": "true"}.
+	// The files of the options are written like on the command line, e.g. stream-output, seen-db, graph and
+	// output=sqlite, and the crawl goes to the output-file option in the format option. Options that only print a
+	// report at the end of the command line, like report-frontier, and verify-list, which does not crawl, are
+	// rejected by New. Options that change what is printed to stdout, like quiet and progress, have no effect.
+	Options map[string]string
+}
+
+// A Crawler crawls web sites with its Config.
+//
+// There is one crawl per process at a time. The options are package-level flags that a Crawler sets when it runs,
+// so Run takes a lock of the package for the whole crawl: when it is called while another crawl is running, of this
+// Crawler or another one, it waits for that crawl to finish first. Run crawlers in separate processes to crawl
+// in parallel.
+type Crawler struct {
+	config Config
+}
+
+// Result is what Crawler.Run found
+type Result struct {
+	StartURL string
+
+	// Pages has every page that was crawled by its canonical URL. It is empty with a custom Fetcher, and with the
+	// stream-output option, which writes the pages to its file instead.
+	Pages map[string]Page
+
+	// Depths has the depth at which every URL was found, which is the number of links followed from the start URL
+	Depths map[string]int
+
+	Stats Stats
+}
+
+// Page is a crawled page
+type Page struct {
+	Title string
+
+	// Status is the HTTP status of the response, 0 when there was none
+	Status int
+
+	// Links are the links found on the page, with the URLs as they were written on it
+	Links []Link
+
+	// Err is why the page could not be fetched, or nil. When that happened halfway, Links has the links read until
+	// then and Truncated is set.
+	Err       error
+	Truncated bool
+
+	// Redirects are the URLs the request was redirected through, ending with the URL of the final response
+	Redirects []string
+
+	// ContentType is the media type of the response, e.g. text/html. Pages of a type without a Parser are not read,
+	// and have Unparsed set.
+	ContentType string
+	Unparsed    bool
+
+	// Description and Canonical are the meta description and the canonical URL of the page, and Assets the URLs of
+	// the scripts, stylesheets and images it loads. They are only set with the extractors of the extract option,
+	// e.g. Options: {"extract": "meta,assets"}.
+	Description string
+	Canonical   string
+	Assets      []string
+}
+
+// Link is a link in an <a> tag, with the rel and type attributes of the tag and the text of the link
+type Link struct {
+	URL  string
+	Rel  string
+	Type string
+	Text string
+}
+
+// Only one crawl can use the options at a time
+var running sync.Mutex
+
+// The options that only make the command line print a report after the crawl, or that do not crawl at all, which
+// Crawler.Run has no place for
+var commandLineOptions = []string{"verify-list", "report-frontier", "report-tls", "report-mixed-content",
+	"report-selflinks", "max-redirect-report", "min-compression-ratio", "compare-titles"}
+
+// New creates a Crawler with the config. It returns an error when one of the Options does not exist, or when it
+// is one that Run cannot do anything with.
+func New(config Config) (*Crawler, error) {
+	for name, value := range config.Options {
+		f := flags.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown option %q", name)
+		}
+		if slices.Contains(commandLineOptions, name) && value != f.DefValue {
+			return nil, fmt.Errorf("option %q is only for the command line", name)
+		}
+	}
+
+	// the command line writes the crawl to stdout, which Run has the Result for instead
+	o := config.Options
+	if o["output-file"] == "" && ((o["format"] != "" && o["format"] != "text") || o["output"] == "urls") {
+		return nil, fmt.Errorf("the format option and output=urls need the output-file option to write the crawl to")
+	}
+
+	return &Crawler{config}, nil
+}
+
+// Run crawls from the start URL and returns what it found. Cancelling the context stops the crawl like --on-page-abort
+// does: the requests that are being made are stopped, and Run returns the pages crawled until then together with the
+// error of the context.
+// With the state-dir and crawl-id options, the state of the crawl is saved like with --state-dir, and the next Run
+// with the same ones continues it without fetching the saved pages again. The files of the other options are written
+// when the crawl is finished, and an error writing them is returned with the Result.
+func (c *Crawler) Run(ctx context.Context, start string) (*Result, error) {
+	running.Lock()
+	defer running.Unlock()
+
+	if err := c.apply(start); err != nil {
+		return nil, err
+	}
+	if err := setup(); err != nil {
+		return nil, err
+	}
+	if crawlStateDir != "" && c.config.Fetcher != nil {
+		return nil, fmt.Errorf("the state of a crawl with a custom Fetcher cannot be saved")
+	}
+	if c.config.Score != nil {
+		score = c.config.Score
+	}
+
+	// a library should not print the progress dots, nor anything else
+	console = io.Discard
+	defer func() { console = os.Stdout }()
+
+	if *metricsAddr != "" {
+		stop, err := serveMetrics(*metricsAddr)
+		if err != nil {
+			return nil, err
+		}
+		defer stop()
+	}
+
+	if c.config.Client != nil {
+		configured := client
+		client = c.config.Client
+		defer func() { client = configured }()
+	}
+
+	// like the command line, check that the start URL can be crawled before anything is written. A custom Fetcher
+	// does not fetch it over HTTP, so then it is up to the Fetcher. When ctx is done meanwhile, the crawl below
+	// stops right away and returns its error.
+	if *failFast && c.config.Fetcher == nil {
+		if err := checkSeed(ctx, *startURL); err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("cannot crawl the start URL: %w", err)
+		}
+	}
+
+	// the files of the options, which are closed when the crawl is finished, or when one of them cannot be opened
+	var files []io.Closer
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	if *streamOutput != "" {
+		var err error
+		if stream, err = newStreamWriter(*streamOutput); err != nil {
+			return nil, err
+		}
+		files = append(files, stream)
+	}
+	if *seenDB != "" {
+		var err error
+		if seenURLs, err = openSeenLog(*seenDB); err != nil {
+			return nil, err
+		}
+		files = append(files, seenURLs)
+	}
+
+	// the crawl only goes to a writer with output-file, see New
+	var results io.Writer
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		results = file
+	}
+
+	stats, _, err := installReporters(results)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range c.config.Reporters {
+		reporters = append(reporters, exportedReporter{r})
+	}
+
+	f := fetcher{}
+	var fetch Fetcher = f
+	if c.config.Fetcher != nil {
+		fetch = c.config.Fetcher
+	}
+
+	began := time.Now()
+	var depths map[string]int
+	if crawlStateDir != "" {
+		var err error
+		if depths, err = crawlWithState(ctx, crawlStateDir, []string{*startURL}, *depth, f); err != nil {
+			return nil, err
+		}
+	} else {
+		depths = Crawl(ctx, []string{*startURL}, *depth, fetch)
+	}
+
+	result := &Result{StartURL: *startURL, Pages: map[string]Page{}, Depths: depths, Stats: stats.Stats(time.Since(began))}
+	for url, r := range f {
+		result.Pages[url] = newPage(r)
+	}
+
+	// every file is written and closed, and the first error is returned
+	err = finishReporters(result.Stats, depths)
+	for _, file := range files {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	files = nil
+
+	if err != nil {
+		return result, err
+	}
+	return result, crawlAborted()
+}
+
+// Set the options to the config, and the others back to their defaults
+func (c *Crawler) apply(start string) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if serr := f.Value.Set(f.DefValue); serr != nil && err == nil {
+			err = serr
+		}
+	})
+
+	options := map[string]string{"url": start}
+	if c.config.Depth != 0 {
+		options["depth"] = strconv.Itoa(c.config.Depth)
+	}
+	if c.config.MaxURLs != 0 {
+		options["max_urls"] = strconv.Itoa(c.config.MaxURLs)
+	}
+	if c.config.Concurrency != 0 {
+		options["max_concurrency"] = strconv.Itoa(c.config.Concurrency)
+	}
+	if c.config.MaxPerHost != 0 {
+		options["max-per-host"] = strconv.Itoa(c.config.MaxPerHost)
+	}
+	if c.config.Delay != 0 {
+		options["delay"] = c.config.Delay.String()
+	}
+	if c.config.Timeout != 0 {
+		options["timeout"] = c.config.Timeout.String()
+	}
+	if c.config.UserAgent != "" {
+		options["user_agent"] = c.config.UserAgent
+	}
+	if c.config.Proxy != "" {
+		options["proxy"] = c.config.Proxy
+	}
+	if c.config.Insecure {
+		options["insecure"] = "true"
+	}
+	if c.config.Cookies {
+		options["cookies"] = "true"
+	}
+	if c.config.SameHost {
+		options["same_host"] = "true"
+	}
+	if c.config.IncludeSubdomains {
+		options["include-subdomains"] = "true"
+	}
+	if c.config.SameDomain {
+		options["same-domain"] = "true"
+	}
+	if c.config.Allow != "" {
+		options["allow"] = c.config.Allow
+	}
+	if c.config.Deny != "" {
+		options["deny"] = c.config.Deny
+	}
+	for name, value := range c.config.Options {
+		options[name] = value
+	}
+
+	for name, value := range options {
+		if serr := flags.Set(name, value); serr != nil && err == nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, name, serr)
+		}
+	}
+
+	for name, value := range c.config.Headers {
+		if serr := flags.Set("header", name+": "+value); serr != nil && err == nil {
+			err = fmt.Errorf("invalid header %q: %v", name, serr)
+		}
+	}
+
+	return err
+}
+
+// Convert a result to its exported form
+func newPage(r *result) Page {
+	p := Page{Title: r.title, Status: r.status, Err: r.err, Truncated: r.truncated, Redirects: r.redirects,
+		ContentType: r.contentType, Unparsed: r.unparsed, Description: r.description, Canonical: r.canonical,
+		Assets: r.assets}
+	for _, l := range r.links {
+		p.Links = append(p.Links, Link{l.url, l.rel, l.typ, l.text})
+	}
+
+	return p
+}
+
+// Forget what an earlier crawl in this process left behind, so the next one starts afresh
+func reset() {
+	runID = newRunID()
+	countCrawled.Store(0)
+	score = inverseDepth
+	robotsDisallowed.Store(0)
+	uniqueURLs.Store(0)
+	reporters = nil
+	seenURLs = nil
+	stream = nil
+
+	abort.Lock()
+	abort.err = nil
+	abort.ctx, abort.cancel = context.WithCancelCause(context.Background())
+	abort.Unlock()
+
+	<-paginationAccess
+	paginationAccess <- map[string]int{}
+
+	hostTitles.Lock()
+	hostTitles.counts = map[string]map[string]int{}
+	hostTitles.stopped = map[string]bool{}
+	hostTitles.Unlock()
+
+	titleChanges.Lock()
+	titleChanges.changes = nil
+	titleChanges.Unlock()
+
+	robotsCache.Lock()
+	robotsCache.hosts = map[string]*hostRobots{}
+	robotsCache.Unlock()
+
+	cssCache.Lock()
+	cssCache.sheets = map[string]*cssSheet{}
+	cssCache.Unlock()
+
+	linkChecks.Lock()
+	linkChecks.queue = nil
+	linkChecks.queued = map[string]bool{}
+	linkChecks.m = map[string]linkCheck{}
+	linkChecks.Unlock()
+
+	scopeSkipped.Lock()
+	scopeSkipped.counts = map[string]int{}
+	scopeSkipped.Unlock()
+
+	hostLimits.Lock()
+	hostLimits.hosts = map[string]*hostLimit{}
+	hostLimits.Unlock()
+}
@@ -0,0 +1,222 @@
+package crawler
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// A queryRule marks the query parameters of a host, or of a path prefix on a host, as significant
+type queryRule struct {
+	host string
+	path string
+}
+
+// The rules from --allow-query-params-only-for-hosts, set by setup.
+// When there are no rules, query parameters are always significant.
+var queryRules []queryRule
+
+// The file names from --default-documents, which servers show for a directory. Set by setup.
+var defaultDocuments []string
+
+// The query parameters that only tell the site where a visitor came from, which --strip-tracking-params drops.
+// The names ending in _ are prefixes.
+var trackingParams = []string{"utm_", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid", "_ga", "yclid"}
+
+// Whether a query parameter is one of the trackingParams
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range trackingParams {
+		if name == p || (strings.HasSuffix(p, "_") && strings.HasPrefix(name, p)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Drop the trackingParams from the query of u. The query is only rewritten when one of them was in it,
+// so the other parameters keep their order.
+func stripTrackingParams(u *url.URL) {
+	query := u.Query()
+	stripped := false
+	for name := range query {
+		if isTrackingParam(name) {
+			query.Del(name)
+			stripped = true
+		}
+	}
+
+	if stripped {
+		u.RawQuery = query.Encode()
+		u.ForceQuery = false
+	}
+}
+
+// Parse a comma separated list of hosts and host/path prefixes, e.g. "search.example.com,example.com/search"
+func parseQueryRules(s string) []queryRule {
+	rules := []queryRule{}
+
+	for _, r := range strings.Split(s, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		host, path := r, ""
+		if i := strings.Index(r, "/"); i >= 0 {
+			host, path = r[:i], r[i:]
+		}
+		rules = append(rules, queryRule{strings.ToLower(host), path})
+	}
+
+	return rules
+}
+
+// Whether the query parameters of u matter for telling pages apart
+func querySignificant(u *url.URL) bool {
+	if len(queryRules) == 0 {
+		return true
+	}
+
+	for _, r := range queryRules {
+		if strings.ToLower(u.Hostname()) == r.host && underPath(u.Path, r.path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether path is the prefix itself or below it. The prefix ends at a segment, so /search does not cover /searchable.
+func underPath(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// normalizeURL returns the form of a URL that is used to decide whether we have already visited it.
+// URLs that cannot be parsed are returned unchanged.
+func normalizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	// the fragment is a place on the page, not another page, and host names are case insensitive.
+	// url.Parse already lowercases the scheme
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Host = strings.ToLower(u.Host)
+
+	// and the default port of the scheme is the same as no port
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+u.Port())
+	}
+
+	// http://example.com is the same page as http://example.com/
+	if u.Host != "" && u.Path == "" && u.Opaque == "" {
+		u.Path = "/"
+	}
+
+	// example.com. is the fully qualified form of example.com, so it is the same host
+	if host := u.Hostname(); strings.HasSuffix(host, ".") {
+		u.Host = joinHostPort(strings.TrimSuffix(host, "."), u.Port())
+	}
+
+	// internationalized hosts can be written in Unicode or in punycode, so use the ASCII form for both
+	if *normalizeUnicode {
+		if host, err := idna.Lookup.ToASCII(u.Hostname()); err == nil {
+			u.Host = joinHostPort(host, u.Port())
+		}
+	}
+
+	if !querySignificant(u) {
+		u.RawQuery = ""
+		u.ForceQuery = false
+	} else if *stripTracking {
+		stripTrackingParams(u)
+	}
+
+	// /docs/index.html is usually the same page as /docs/
+	if *normalizeDefaultDocs {
+		dir, file := path.Split(u.Path)
+		for _, doc := range defaultDocuments {
+			if strings.EqualFold(file, doc) {
+				u.Path = dir
+				u.RawPath = ""
+				break
+			}
+		}
+	}
+
+	// and /docs/ is usually the same page as /docs
+	if *normalizeTrailingSlash && len(u.Path) > 1 && strings.HasSuffix(u.Path, "/") {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+
+	return u.String()
+}
+
+// Join a host and a port as in a URL, where the port may be empty
+func joinHostPort(host, port string) string {
+	if port == "" {
+		return host
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// Resolve a possibly relative reference against the URL of the page it was found on
+func resolve(base, ref string) (string, bool) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", false
+	}
+
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", false
+	}
+
+	return b.ResolveReference(r).String(), true
+}
+
+// The number of segments in the path of a URL: 0 for http://example.com/, and 3 for both /a/b/c and /a/b/c/
+func pathDepth(u string) int {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return 0
+	}
+
+	path := strings.Trim(parsed.Path, "/")
+	if path == "" {
+		return 0
+	}
+
+	return strings.Count(path, "/") + 1
+}
+
+// Whether the URL u is in the directory of the page, or below it, on the same host.
+// The directory of http://example.com/docs/guide/intro.html is http://example.com/docs/guide/
+func inDirectory(page, u string) bool {
+	p, err := url.Parse(page)
+	if err != nil {
+		return false
+	}
+
+	l, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+
+	dir := p.Path[:strings.LastIndex(p.Path, "/")+1]
+
+	return strings.EqualFold(p.Host, l.Host) && strings.HasPrefix(l.Path, dir)
+}
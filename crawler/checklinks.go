@@ -0,0 +1,179 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A brokenLink is a link on a crawled page to a URL that could not be fetched, or that answered with a 4xx or 5xx
+// status, with the text of the link
+type brokenLink struct {
+	target string
+	status int
+	err    error
+	text   string
+}
+
+// The outcome of checking a URL: its status after redirects, or why there was none
+type linkCheck struct {
+	status int
+	err    error
+}
+
+// The links to check for --check-links: the ones that are queued to be checked by the next level of the crawl,
+// every one that was ever queued, and the outcomes of the ones that were checked, by URL. Reset by reset.
+var linkChecks = struct {
+	sync.Mutex
+	queue  []string
+	queued map[string]bool
+	m      map[string]linkCheck
+}{queued: map[string]bool{}, m: map[string]linkCheck{}}
+
+// The broken links on the crawled pages, by the page they are on, for --check-links. A link to a page that was
+// crawled is broken when fetching that page failed, and a link to a URL that was not crawled when checking it did.
+func brokenLinks(f fetcher) map[string][]brokenLink {
+	linkChecks.Lock()
+	defer linkChecks.Unlock()
+
+	broken := map[string][]brokenLink{}
+	for _, page := range f.sortedURLs() {
+		seen := map[string]bool{}
+		for _, l := range f[page].links {
+			target := normalizeURL(l.url)
+			if seen[target] {
+				continue
+			}
+			seen[target] = true
+
+			// a page that broke off halfway is there, so the links to it are not broken
+			c, ok := linkChecks.m[target]
+			if r, crawled := f[target]; crawled && !r.truncated {
+				c, ok = linkCheck{r.status, r.err}, true
+			}
+
+			if ok && (c.err != nil || c.status >= 400) {
+				broken[page] = append(broken[page], brokenLink{l.url, c.status, c.err, l.text})
+			}
+		}
+	}
+
+	return broken
+}
+
+// Queue the links to be checked for --check-links, since they are not crawled. Only http(s) links are checked,
+// and every one of them once.
+func queueChecks(urls []string) {
+	if !*checkLinks {
+		return
+	}
+
+	linkChecks.Lock()
+	defer linkChecks.Unlock()
+
+	for _, u := range urls {
+		if !linkChecks.queued[u] && (strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) {
+			linkChecks.queued[u] = true
+			linkChecks.queue = append(linkChecks.queue, u)
+		}
+	}
+}
+
+// The tasks to check the links that were queued, which are no longer queued after this
+func checkTasks() []crawlTask {
+	linkChecks.Lock()
+	defer linkChecks.Unlock()
+
+	tasks := []crawlTask{}
+	for _, u := range linkChecks.queue {
+		tasks = append(tasks, crawlTask{url: u, check: true})
+	}
+	linkChecks.queue = nil
+
+	return tasks
+}
+
+// Check the link url for --check-links, keeping to robots.txt, --max-per-host and --delay like Crawl does.
+// It is not fetched, parsed or followed, the status is all we want.
+func (c *crawlHistory) Check(url string) {
+	if crawlAborted() != nil || !robotsAllowed(url) {
+		return
+	}
+	waitCrawlDelay(url)
+	done := waitHostTurn(url)
+
+	// the crawl may have been aborted while we waited our turn
+	if crawlAborted() != nil {
+		done()
+		return
+	}
+
+	status, err := headURL(url)
+	done()
+
+	linkChecks.Lock()
+	linkChecks.m[url] = linkCheck{status, err}
+	linkChecks.Unlock()
+	fmt.Fprint(console, ".")
+}
+
+// Send a HEAD request for url and return its status code after following redirects. Some servers do not
+// support HEAD, so when they say so, the page is fetched with a GET request instead.
+func headURL(url string) (int, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return 0, err
+	}
+	req.Method = http.MethodHead
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		return verifyURL(url)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Print the broken links by the page they are on, with their status or error and their text.
+// It returns the number of broken links.
+func printBrokenLinks(f fetcher) int {
+	pages := brokenLinks(f)
+
+	urls := []string{}
+	n := 0
+	for url, links := range pages {
+		urls = append(urls, url)
+		n += len(links)
+	}
+	sort.Strings(urls)
+
+	fmt.Fprintf(console, "\n=== Broken links (%d on %d pages)\n", n, len(urls))
+	for _, url := range urls {
+		fmt.Fprintf(console, "%v (%v)\n", url, f[url].title)
+		for _, l := range pages[url] {
+			if l.err != nil {
+				fmt.Fprintf(console, "|-- %v (error: %v)", l.target, l.err)
+			} else {
+				fmt.Fprintf(console, "|-- %v (%d %s)", l.target, l.status, http.StatusText(l.status))
+			}
+			if l.text != "" {
+				fmt.Fprintf(console, " %q", l.text)
+			}
+			fmt.Fprintln(console)
+		}
+	}
+
+	return n
+}
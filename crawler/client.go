@@ -0,0 +1,260 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// The client that is used for every request, set up from the command line flags by configureClient
+var client = &http.Client{}
+
+// Set up the client from the command line flags and the config file
+func configureClient() error {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = proxyFor
+
+	if *proxyFlag != "" {
+		if _, err := url.Parse(*proxyFlag); err != nil {
+			return fmt.Errorf("invalid --proxy: %v", err)
+		}
+	}
+
+	if *insecure {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	// crawl file:// URLs straight from the file system, so a static site can be checked before it is published.
+	// Only a crawl that starts from a file can read files, so a web page can never make us read one.
+	if strings.HasPrefix(strings.ToLower(*startURL), "file://") {
+		t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	}
+
+	if *http1 {
+		// an empty (but not nil) map of protocols disables HTTP/2 over TLS
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	client.Transport = t
+
+	// with a client certificate, requests to the hosts that need it go through a transport that presents it,
+	// and all other requests through one that does not, so the certificate is never shown to other servers
+	if *clientCert != "" || *clientKey != "" {
+		cert, err := tls.LoadX509KeyPair(*clientCert, *clientKey)
+		if err != nil {
+			return fmt.Errorf("cannot load client certificate: %v", err)
+		}
+
+		mt := t.Clone()
+		if mt.TLSClientConfig == nil {
+			mt.TLSClientConfig = &tls.Config{}
+		}
+		mt.TLSClientConfig.Certificates = []tls.Certificate{cert}
+
+		hosts := *clientCertHosts
+		if hosts == "" {
+			if u, err := url.Parse(*startURL); err == nil {
+				hosts = u.Hostname()
+			}
+		}
+		client.Transport = &certRouter{parseHostPatterns(hosts), mt, t}
+	}
+
+	// the --header flags are sent to the host of the start URL only, like the headers of a host in the config file,
+	// so credentials in them do not leak to other sites. They override the ones in the config file.
+	if len(headerFlags) > 0 {
+		host := ""
+		if u, err := url.Parse(*startURL); err == nil {
+			host = strings.ToLower(u.Hostname())
+		}
+		if cfg.Headers == nil {
+			cfg.Headers = map[string]map[string]string{}
+		}
+		if cfg.Headers[host] == nil {
+			cfg.Headers[host] = map[string]string{}
+		}
+		for _, h := range headerFlags {
+			cfg.Headers[host][h.name] = h.value
+		}
+	}
+
+	// the jar keeps the cookies for the hosts that set them, so a crawl behind a login keeps its session
+	client.Jar = nil
+	if *cookieJar || *cookieFlag != "" {
+		jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		if err != nil {
+			return err
+		}
+
+		if *cookieFlag != "" {
+			cookies, err := http.ParseCookie(*cookieFlag)
+			if err != nil {
+				return fmt.Errorf("invalid --cookie: %v", err)
+			}
+			u, err := url.Parse(*startURL)
+			if err != nil {
+				return err
+			}
+			jar.SetCookies(u, cookies)
+		}
+		client.Jar = jar
+	}
+
+	// the client copies the headers of a request when it follows a redirect, which could send the headers
+	// of one host to another, so set them again for the host we are redirected to
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		// a local file may link to a web page, but a web page may not redirect to a local file
+		if req.URL.Scheme == "file" && via[0].URL.Scheme != "file" {
+			return fmt.Errorf("not following the redirect from %s to a local file", via[0].URL.Scheme)
+		}
+		setHostHeaders(req)
+		return nil
+	}
+
+	return nil
+}
+
+// A header of --header, which can be given more than once
+type header struct {
+	name, value string
+}
+
+// The headers of the --header flags. Setting it to "" removes them all, which is how Crawler.Run resets it.
+type headerList []header
+
+func (h *headerList) String() string {
+	s := []string{}
+	for _, hd := range *h {
+		s = append(s, hd.name+": "+hd.value)
+	}
+	return strings.Join(s, ", ")
+}
+
+func (h *headerList) Set(s string) error {
+	if s == "" {
+		*h = nil
+		return nil
+	}
+
+	name, value, ok := strings.Cut(s, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("a header must be given as \"Name: value\"")
+	}
+	*h = append(*h, header{http.CanonicalHeaderKey(strings.TrimSpace(name)), strings.TrimSpace(value)})
+
+	return nil
+}
+
+// A certRouter sends the requests to the hosts in the patterns through the transport with the client certificate,
+// and the others through the plain transport
+type certRouter struct {
+	hosts []string
+	mtls  http.RoundTripper
+	plain http.RoundTripper
+}
+
+func (r *certRouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if matchHost(r.hosts, req.URL.Hostname()) {
+		return r.mtls.RoundTrip(req)
+	}
+
+	return r.plain.RoundTrip(req)
+}
+
+// Parse a comma separated list of hosts, where *.example.com stands for every host under example.com
+func parseHostPatterns(s string) []string {
+	patterns := []string{}
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+
+	return patterns
+}
+
+// Whether the host matches one of the patterns
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, p := range patterns {
+		if domain, ok := strings.CutPrefix(p, "*."); ok {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Choose the proxy for a request with the proxy rules from the config file. Without a rule for the host,
+// --proxy is used, and without that the proxy from the environment, like the default client does.
+func proxyFor(req *http.Request) (*url.URL, error) {
+	switch proxy := cfg.proxyRule(req.URL.Hostname()); proxy {
+	case "":
+		if *proxyFlag != "" {
+			return url.Parse(*proxyFlag)
+		}
+		return http.ProxyFromEnvironment(req)
+	case "DIRECT":
+		return nil, nil
+	default:
+		return url.Parse(proxy)
+	}
+}
+
+// Set the headers from the config file for the host of the request, and remove those of any other host.
+// Every request gets the --user_agent too.
+func setHostHeaders(req *http.Request) {
+	host := strings.ToLower(req.URL.Hostname())
+
+	for h, headers := range cfg.Headers {
+		if h != host {
+			for k := range headers {
+				req.Header.Del(k)
+			}
+		}
+	}
+
+	// set after removing the headers of the other hosts, in case one of those has a User-Agent, and before adding
+	// the ones of this host, so the config file can still override it
+	if *userAgent != "" {
+		req.Header.Set("User-Agent", *userAgent)
+	}
+
+	for k, v := range cfg.Headers[host] {
+		req.Header.Set(k, v)
+	}
+}
+
+// Create a GET request for url, with the headers for its host and the connection handling asked for on the command line
+func newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	setHostHeaders(req)
+
+	if *http1 {
+		req.Header.Set("Connection", "close")
+	}
+	if *forceClose {
+		req.Close = true
+	}
+
+	return req, nil
+}
@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// The encodings we ask for in Fetch. The client only decompresses responses by itself when it chose the encoding,
+// and then it hides how many bytes were transferred, so we ask for them ourselves and decompress them in decodeBody.
+const acceptEncoding = "gzip, deflate"
+
+// Decode the body of a response with the encoding in its Content-Encoding. Raw counts the bytes as they were
+// transferred, and body reads the page itself.
+func decodeBody(resp *http.Response) (raw *countingReader, body io.Reader, err error) {
+	raw = &countingReader{r: resp.Body}
+
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip", "x-gzip":
+		body, err = gzip.NewReader(raw)
+	case "deflate":
+		body, err = zlib.NewReader(raw)
+	default:
+		return raw, raw, nil
+	}
+
+	// an empty body is not compressed, whatever its header says
+	if errors.Is(err, io.EOF) {
+		return raw, raw, nil
+	}
+
+	return raw, body, err
+}
+
+// The compression ratio of a page: the bytes of the page divided by the bytes transferred for it.
+// Uncompressed pages have ratio 1, and pages without a body have ratio 0.
+func compressionRatio(r *result) float64 {
+	if r.transferred == 0 {
+		return 0
+	}
+
+	return float64(r.size) / float64(r.transferred)
+}
+
+// The pages that were transferred with a compression ratio below min, sorted from the worst ratio to the best
+func poorlyCompressed(f fetcher, min float64) []string {
+	urls := []string{}
+	for url, result := range f {
+		if result.transferred > 0 && compressionRatio(result) < min {
+			urls = append(urls, url)
+		}
+	}
+
+	sort.Slice(urls, func(i, j int) bool {
+		if ri, rj := compressionRatio(f[urls[i]]), compressionRatio(f[urls[j]]); ri != rj {
+			return ri < rj
+		}
+		return urls[i] < urls[j]
+	})
+
+	return urls
+}
+
+// Print the pages with a compression ratio below min, with the bytes transferred and the size of the page
+func printCompressionReport(f fetcher, min float64) {
+	urls := poorlyCompressed(f, min)
+
+	fmt.Fprintf(console, "\n=== Pages compressed less than %.1fx (%d)\n", min, len(urls))
+	for _, url := range urls {
+		r := f[url]
+		fmt.Fprintf(console, "%v (%d bytes transferred, %d bytes, ratio %.2f)\n", url, r.transferred, r.size, compressionRatio(r))
+	}
+}
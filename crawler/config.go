@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// The config file holds the settings that are too elaborate for command line flags. It is a JSON file, e.g.
+//
+//	{
+//	    "headers": {
+//	        "api.example.com": {"Authorization": "Bearer 1234"},
+//	        "other.example.com": {"X-Api-Key": "5678"}
+//	    },
+//	    "proxies": {
+//	        "*.internal.example.com": "socks5://localhost:1080",
+//	        "public.internal.example.com": "DIRECT",
+//	        "*": "http://proxy.example.com:3128"
+//	    }
+//	}
+type config struct {
+	// Headers maps a host to the extra headers that are sent with every request to that host, and only that host
+	Headers map[string]map[string]string `json:"headers"`
+
+	// Proxies maps a host pattern to the proxy URL to reach it through, or DIRECT to connect without a proxy.
+	// A pattern is a host, *.domain for every host under domain, or * for every host. The most specific
+	// pattern that matches is used, and hosts without one use the proxy from the environment (HTTP_PROXY etc).
+	Proxies map[string]string `json:"proxies"`
+}
+
+// The config loaded from --config, empty when there is none
+var cfg config
+
+// Load the config file at path
+func loadConfig(path string) (config, error) {
+	c := config{}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+
+	// hosts are matched case insensitively
+	headers := map[string]map[string]string{}
+	for host, h := range c.Headers {
+		headers[strings.ToLower(host)] = h
+	}
+	c.Headers = headers
+
+	proxies := map[string]string{}
+	for pattern, proxy := range c.Proxies {
+		if proxy != "DIRECT" {
+			if _, err := url.Parse(proxy); err != nil {
+				return c, fmt.Errorf("invalid proxy for %s: %v", pattern, err)
+			}
+		}
+		proxies[strings.ToLower(pattern)] = proxy
+	}
+	c.Proxies = proxies
+
+	return c, nil
+}
+
+// Find the proxy rule for a host: the proxy URL, DIRECT, or "" when no pattern matches it
+func (c config) proxyRule(host string) string {
+	host = strings.ToLower(host)
+	if proxy, ok := c.Proxies[host]; ok {
+		return proxy
+	}
+
+	// the longest *.domain pattern is the most specific one
+	rule, longest := "", 0
+	for pattern, proxy := range c.Proxies {
+		if domain, ok := strings.CutPrefix(pattern, "*."); ok && len(domain) > longest {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				rule, longest = proxy, len(domain)
+			}
+		}
+	}
+	if rule != "" {
+		return rule
+	}
+
+	return c.Proxies["*"]
+}
@@ -0,0 +1,1396 @@
+// Package crawler is the web crawler behind the gocrawler command line tool. Other programs can crawl with it too,
+// see New and Crawler.Run, and bring their own Fetcher.
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The options of the crawl. They are the command line flags of gocrawler, and Crawler.Run sets them from its Config.
+// They are not on the flag.CommandLine, so importing the package does not add them to the flags of other programs.
+var flags = flag.NewFlagSet("gocrawler", flag.ExitOnError)
+
+var configPath = flags.String("config", "", "JSON config file with per host settings")
+var startURL = flags.String("url", "http://www.marcvanzee.nl", "The URL to start crawling from")
+var depth = flags.Int("depth", 2, "Depth of the search")
+var maxURLS = flags.Int("max_urls", 150, "Maximal number of URLs to crawl")
+var sitemapFlag = flags.String("sitemap", "", "Comma separated sitemap URLs whose pages are crawled along with the start URL, at depth 1")
+var useSitemap = flags.Bool("use-sitemap", false, "Find the sitemaps and RSS/Atom feeds of the start URL, and add their pages to the crawl at depth 1")
+var robotsSitemapsFlag = flags.Bool("robots-sitemaps", false, "Also crawl the pages in the sitemaps listed in the robots.txt of the start URL")
+var maxConcurrency = flags.Int("max_concurrency", 20, "Maximal number of pages to fetch at the same time")
+var maxPerHost = flags.Int("max-per-host", 0, "Maximal number of pages of one host to fetch at the same time (0 means no limit)")
+var politeDelay = flags.Duration("delay", 0, "Minimal time between the requests to one host")
+
+var maxPathDepth = flags.Int("max-path-depth", 0, "Do not crawl URLs with more than this many path segments (0 means no limit)")
+var maxPerLevel = flags.Int("max-per-level", 0, "Maximal number of URLs to crawl at every depth (0 means no limit)")
+var timeout = flags.Duration("timeout", 10*time.Second, "Maximal time to fetch a page, including reading its body")
+var maxDuration = flags.Duration("max-duration", 0, "Maximal time the whole crawl may take, after which it stops (0 means no limit)")
+var maxPagination = flags.Int("max-pagination", 0, "Maximal number of rel=\"next\" links to follow in a row (0 means no limit)")
+var titleMaxLen = flags.Int("title-max-len", 0, "Truncate titles longer than this many characters (0 means no limit)")
+var userAgent = flags.String("user_agent", "gocrawler", "User-Agent header to send with every request, which robots.txt rules are matched with")
+var respectRobots = flags.Bool("respect_robots", true, "Do not crawl the URLs that the robots.txt of their host disallows for --user_agent")
+var ignoreRobots = flags.Bool("ignore-robots", false, "Ignore robots.txt, the same as --respect_robots=false")
+var http1 = flags.Bool("http1", false, "Only use HTTP/1.1 and close the connection after every request")
+var forceClose = flags.Bool("force-close", false, "Close the connection after every request")
+var clientCert = flags.String("client-cert", "", "PEM file with the client certificate for servers that require mutual TLS")
+var clientKey = flags.String("client-key", "", "PEM file with the private key of --client-cert")
+var clientCertHosts = flags.String("client-cert-hosts", "", "Comma separated hosts to present --client-cert to, *.example.com for every host under it (default: the host of the start URL)")
+var insecure = flags.Bool("insecure", false, "Do not verify TLS certificates, e.g. for servers with a self-signed certificate")
+var proxyFlag = flags.String("proxy", "", "Proxy to send every request through, http://, https:// or socks5:// (default: from the environment)")
+var cookieJar = flags.Bool("cookies", false, "Keep the cookies that servers set, and send them back like a browser does")
+var cookieFlag = flags.String("cookie", "", "Cookies to send to the host of the start URL, as name=value; name2=value2 (implies --cookies)")
+var headerFlags headerList
+
+var retries = flags.Int("retries", 2, "Number of times to fetch a page again when it times out, returns a 5xx status or breaks off")
+var maxBodySize = flags.Int64("max-body-size", 10<<20, "Maximal number of bytes to read from a page")
+var parsersFlag = flags.String("parsers", "", "Comma separated parsers for pages that are not HTML: css, json and text")
+var sinceDate = flags.String("since", "", "Only crawl pages modified after this date (2006-01-02 or RFC 3339)")
+var contentSelectorFlag = flags.String("content-selector", "", "Only take links from inside the element matching this selector (tag, tag#id or tag.class)")
+var extractMedia = flags.Bool("extract-media", false, "Record the audio and video source URLs of every page")
+var anchorTextMatch = flags.String("anchor-text-match", "", "Only follow links whose text matches this regular expression")
+var extractImages = flags.Bool("extract-images", false, "Record the images of every page, with every candidate of their srcset")
+var extractHeadings = flags.Bool("extract-headings", false, "Record the outline of h1-h6 headings of every page")
+var extractFlag = flags.String("extract", "", "Comma separated extractors for more of every page: meta, assets, headings, images and media")
+var respectNofollow = flags.Bool("respect-nofollow", false, "Record the links with rel=\"nofollow\", but do not follow them")
+var sameHost = flags.Bool("same_host", false, "Only follow links to the host of the start URL, where www.example.com is the same host as example.com")
+var includeSubdomains = flags.Bool("include-subdomains", false, "With --same_host, also follow links to the hosts under the host of the start URL")
+var sameDomain = flags.Bool("same-domain", false, "Only follow links to the registrable domain of the start URL, e.g. example.co.uk, and its subdomains")
+var allowFlag = flags.String("allow", "", "Only follow links whose URL matches this regular expression")
+var denyFlag = flags.String("deny", "", "Do not follow links whose URL matches this regular expression")
+var sameDirectory = flags.Bool("same-directory", false, "Only follow links in the directory of the page they are on, or below it")
+var parseCSS = flags.Bool("parse-css", false, "Also crawl the pages referred to by url(...) and @import in linked stylesheets")
+var checkLinks = flags.Bool("check-links", false, "Check the links to pages that are not crawled too, and report the broken links")
+var verifyListPath = flags.String("verify-list", "", "Only check that every URL in this file (one per line) resolves, without crawling")
+var streamOutput = flags.String("stream-output", "", "Write every page to this file as a line of JSON as soon as it is crawled, instead of keeping it in memory")
+var flushInterval = flags.Duration("flush-interval", time.Second, "How often to write the buffered pages to the --stream-output file (0 means only when the buffer is full)")
+var streamAppend = flags.Bool("stream-append", false, "Append to the --stream-output file instead of overwriting it, the other outputs are always overwritten")
+var approxDedup = flags.Bool("approx-dedup", false, "Remember visited URLs in a Bloom filter, which uses little memory but may skip some pages")
+var approxDedupRate = flags.Float64("approx-dedup-rate", 0.001, "False positive rate of the Bloom filter used with --approx-dedup")
+var approxDedupCapacity = flags.Int("approx-dedup-capacity", 0, "Number of URLs the Bloom filter of --approx-dedup is sized for (0 means 20 times max_urls)")
+var seenDB = flags.String("seen-db", "", "File with the URLs crawled by earlier runs, which are skipped; the URLs crawled now are appended to it")
+var stateDir = flags.String("state-dir", "", "Directory to save the state of crawls in, so they can be resumed")
+var crawlID = flags.String("crawl-id", "default", "Name of the crawl in --state-dir")
+var statePath = flags.String("state", "", "Directory to save the state of this crawl in, so it can be continued with --resume")
+var resume = flags.Bool("resume", false, "Continue the crawl saved with --state or --state-dir instead of starting a new one")
+var stateInterval = flags.Duration("state-interval", 10*time.Second, "How often to save the state of the crawl")
+var output = flags.String("output", "text", "Output mode: text, urls, sqlite, graphml or adjacency")
+var sortURLs = flags.Bool("sort-urls", false, "Sort the URLs printed with --output=urls")
+var progressInterval = flags.Duration("progress", 0, "Print the statistics of the crawl this often instead of a dot per URL found (0 means the dots)")
+var metricsAddr = flags.String("metrics-addr", "", "Serve the statistics of the running crawl on this address, e.g. :8080, at /metrics for Prometheus and at /metrics.json")
+var quiet = flags.Bool("quiet", false, "Do not print the progress of the crawl, only its results")
+var format = flags.String("format", "text", "How to print the crawl with --output=text: text, json or csv for other tools, or sitemap")
+var outputFile = flags.String("output-file", "", "File to write the crawl to with --output=text or urls, instead of stdout")
+var graphMLPath = flags.String("graphml", "crawl.graphml", "Path of the GraphML file written with --output=graphml")
+var onPage = flags.String("on-page", "", "Shell command to run for every page, with the URL as $1 and the body on stdin")
+var onPageConcurrency = flags.Int("on-page-concurrency", 4, "Maximal number of --on-page commands to run at the same time")
+var onPageAbort = flags.Bool("on-page-abort", false, "Stop the crawl when an --on-page command fails")
+var summaryOnly = flags.Bool("summary-only", false, "Only print the statistics of the crawl, not the crawled URLs")
+var adjacencyPath = flags.String("adjacency", "crawl.json", "Path of the JSON adjacency list written with --output=adjacency")
+var graphPath = flags.String("graph", "", "File to write the link graph of the crawl to, along with the other output")
+var graphFormat = flags.String("graph-format", "dot", "Format of the --graph file: dot for Graphviz, graphml for e.g. Gephi, or jsonl with one edge per line")
+var groupByStatus = flags.Bool("group-by-status", false, "Print the crawled URLs grouped by response status")
+var reportDuplicateTitles = flags.Bool("duplicate-titles", false, "Report titles that are shared by more than one page")
+var reportFrontier = flags.Bool("report-frontier", false, "Report the URLs that were found but not crawled when the crawl stopped")
+var maxRedirectReport = flags.Int("max-redirect-report", 0, "Report the URLs that go through more than this many redirects (0 means no report)")
+var minCompressionRatio = flags.Float64("min-compression-ratio", 0, "Report the pages that were compressed less than this ratio (0 means no report)")
+var compareTitles = flags.String("compare-titles", "", "Report the pages whose title changed since the crawl written to this --stream-output file")
+var duplicateTitleThreshold = flags.Int("duplicate-title-threshold", 0, "Warn when more than this many pages of a host have the same title (0 means never)")
+var duplicateTitleStop = flags.Bool("duplicate-title-stop", false, "Stop crawling a host when it passes --duplicate-title-threshold")
+var reportSelfLinks = flags.Bool("report-selflinks", false, "Report the pages that link to themselves")
+var reportMixedContent = flags.Bool("report-mixed-content", false, "Report the HTTPS pages that load images, scripts or stylesheets over http://")
+var reportTLS = flags.Bool("report-tls", false, "Report the hosts with invalid or expired TLS certificates")
+var dbPath = flags.String("db", "crawl.db", "Path of the SQLite database written with --output=sqlite")
+var failFast = flags.Bool("fail-fast-on-seed", true, "Check that the start URL is a reachable HTML page before crawling")
+var normalizeUnicode = flags.Bool("normalize-unicode", false, "Convert internationalized host names to punycode, so both forms are the same page")
+var normalizeDefaultDocs = flags.Bool("normalize-default-documents", false, "Treat /dir/index.html and the other --default-documents as /dir/")
+var defaultDocumentsFlag = flags.String("default-documents", "index.html,index.htm,index.php,default.aspx,default.asp,default.htm", "Comma separated file names that servers show for a directory")
+var normalizeTrailingSlash = flags.Bool("normalize-trailing-slash", true, "Treat /dir/ and /dir as the same page, false to tell them apart")
+var stripTracking = flags.Bool("strip-tracking-params", false, "Ignore tracking query parameters like utm_source and fbclid when telling pages apart")
+var queryHosts = flags.String("allow-query-params-only-for-hosts", "", "Comma separated hosts or host/path prefixes whose query parameters are significant; elsewhere they are ignored")
+
+// --concurrency is another name for --max_concurrency, and --header can be given more than once,
+// so they are not declared like the others
+func init() {
+	flags.IntVar(maxConcurrency, "concurrency", 20, "Number of workers that fetch pages, the same as --max_concurrency")
+	flags.Var(&headerFlags, "header", "Header to send to the host of the start URL, as \"Name: value\" (can be given more than once)")
+}
+
+// The number of URLs claimed to crawl so far, which is at most max_urls. Every URL that is crawled holds one,
+// which crawlLevel claims in the order of their score. It is only changed through claimURL.
+var countCrawled atomic.Int64
+
+// Claim one of the max_urls URLs to crawl. It returns false when they are all taken.
+func claimURL() bool {
+	for {
+		n := countCrawled.Load()
+		if n >= int64(*maxURLS) {
+			return false
+		}
+		if countCrawled.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// Where the progress of the crawl and the messages and reports around it are printed: stdout, or stderr when the
+// crawl itself goes to stdout in another format than text, and nowhere with --quiet or in Crawler.Run. Set by Main.
+var console io.Writer = os.Stdout
+
+// Where the --on-page commands write their output: stdout, or stderr when the crawl goes to stdout. Set by Main.
+var commandOutput io.Writer = os.Stdout
+
+// Print a dot for a URL found, unless --progress prints the statistics instead
+func printDot() {
+	if *progressInterval <= 0 {
+		fmt.Fprint(console, ".")
+	}
+}
+
+// The parsed --since date, zero when all pages are crawled
+var since time.Time
+
+// The compiled --anchor-text-match, nil when all links are followed
+var anchorTextPattern *regexp.Regexp
+
+// A Fetcher visit the input url and returns the urls that occur on that website
+// It returns an error when it cannot read the url
+type Fetcher interface {
+	Fetch(url string) (urls []string, err error)
+}
+
+// A ContextFetcher is a Fetcher that gets the context of the crawl as well, which is cancelled when the crawl is
+// aborted, so it can stop the request it is making. The crawl calls FetchContext instead of Fetch then.
+type ContextFetcher interface {
+	Fetcher
+	FetchContext(ctx context.Context, url string) (urls []string, err error)
+}
+
+// The crawhistory consists of an embed Fetcher (https://soniacodes.wordpress.com/2011/10/09/a-tour-of-go-69-exercise-web-crawler/)
+// And an access token for the history, which is the set of URLs seen so far, and the depth to crawl until.
+type crawlHistory struct {
+	Fetcher
+	mapAccess chan visitedSet
+	depth     int
+}
+
+// A URL of the frontier, with the page it was first found on for its Score. The referrer is only kept until the level
+// of the URL is scored, so the crawl does not remember it for every URL it has seen.
+type frontierURL struct {
+	url      string
+	referrer string
+}
+
+// The crawl function that is called by Main and Crawler.Run, which crawls from the start URL and any other seeds,
+// e.g. from a sitemap. It returns the depth (number of links followed from a seed) at which every URL was found,
+// which is empty with --approx-dedup since the Bloom filter does not keep the URLs.
+// When ctx is done, the crawl stops like it does with --on-page-abort, and the depths of the URLs found until then
+// are returned.
+func Crawl(ctx context.Context, seeds []string, depth int, fetcher Fetcher) map[string]int {
+	var visited visitedSet = exactSet{}
+	if *approxDedup {
+		visited = newBloomSet(bloomCapacity(), *approxDedupRate)
+	}
+
+	c := newCrawlHistory(fetcher, visited, depth)
+	c.crawlFrontier(ctx, seedFrontier(visited, seeds))
+
+	return c.depths()
+}
+
+// Add the seeds to visited and return them as the frontier to start crawling from, all at depth 0.
+// The first seed is the start URL, the others count towards max_urls like the URLs found on pages do, when they
+// are crawled.
+// The pages in the sitemaps and feeds of the start URL are added as well, at depth 1, as if the start URL linked to
+// them, see discoverSeeds.
+func seedFrontier(visited visitedSet, seeds []string) map[string]int {
+	frontier := map[string]int{}
+
+	add := func(url string, depth int) {
+		url = normalizeURL(url)
+		if !inScope(url) || (seenURLs != nil && seenURLs.Seen(url)) {
+			return
+		}
+		if !visited.Add(url, depth) {
+			return
+		}
+
+		uniqueURLs.Add(1)
+		frontier[url] = depth
+	}
+
+	for i, url := range seeds {
+		// the start URL is always crawled, whatever the options say
+		if i == 0 {
+			if url = normalizeURL(url); visited.Add(url, 0) {
+				uniqueURLs.Add(1)
+				frontier[url] = 0
+			}
+			continue
+		}
+		add(url, 0)
+	}
+
+	if len(seeds) > 0 {
+		for _, url := range discoverSeeds(seeds[0]) {
+			add(url, 1)
+		}
+	}
+
+	return frontier
+}
+
+// Create the crawlhistory for a crawl up to the given depth, with the URLs seen so far in visited
+func newCrawlHistory(fetcher Fetcher, visited visitedSet, depth int) *crawlHistory {
+	c := &crawlHistory{
+		fetcher,
+		make(chan visitedSet, 1),
+		depth,
+	}
+
+	// the first crawler has access to the history in the crawhistory
+	c.mapAccess <- visited
+
+	return c
+}
+
+// Crawl the URLs in the frontier, which maps every URL to the depth at which it was found.
+// The crawl is breadth first: all URLs at one depth are crawled before the URLs found on them, so every URL
+// is found along a shortest path from the start URL, and the depth limit applies to that shortest path.
+// When ctx is done, the crawl is aborted: the requests that are being made are stopped, and no new ones are started.
+func (c *crawlHistory) crawlFrontier(ctx context.Context, frontier map[string]int) {
+	// AfterFunc runs in its own goroutine, so a context that is already done is aborted here, before the first fetch
+	if ctx.Err() != nil {
+		abortCrawl(context.Cause(ctx))
+	}
+	stop := context.AfterFunc(ctx, func() { abortCrawl(context.Cause(ctx)) })
+	defer stop()
+	liveMetrics.begin()
+
+	levels := map[int][]frontierURL{}
+	for url, depth := range frontier {
+		levels[depth] = append(levels[depth], frontierURL{url: url})
+	}
+
+	for depth := 0; depth < c.depth; depth++ {
+		levels[depth+1] = append(levels[depth+1], c.crawlLevel(levels[depth], depth)...)
+	}
+
+	// the URLs at the maximal depth are never crawled, but the links to them are checked with --check-links
+	if *checkLinks {
+		unchecked := []string{}
+		for _, u := range levels[c.depth] {
+			unchecked = append(unchecked, u.url)
+		}
+		queueChecks(unchecked)
+		c.runTasks(checkTasks(), c.depth)
+	}
+}
+
+// A task of a crawl level: a URL to crawl, or with check a link to check for --check-links without crawling it
+type crawlTask struct {
+	url   string
+	check bool
+}
+
+// Crawl all URLs at one depth concurrently, starting with the ones with the highest score,
+// and return the URLs found on them that were not seen before.
+// Every URL takes one of the max_urls slots, so when they run out, only the best scoring URLs are crawled.
+// With --max-per-level, only the best scoring URLs are crawled as well. The rest stay in the frontier.
+// With --check-links, the URLs that are left out are checked instead, after the ones that are crawled, together with
+// the links that were not followed on the level before.
+func (c *crawlHistory) crawlLevel(level []frontierURL, depth int) []frontierURL {
+	urls := prioritize(level, depth)
+	if *maxPerLevel > 0 && len(urls) > *maxPerLevel {
+		queueChecks(urls[*maxPerLevel:])
+		urls = urls[:*maxPerLevel]
+	}
+	claimed, unclaimed := claimURLs(urls)
+	queueChecks(unclaimed)
+	liveMetrics.queued.Store(int64(len(claimed)))
+
+	tasks := []crawlTask{}
+	for _, url := range claimed {
+		tasks = append(tasks, crawlTask{url: url})
+	}
+
+	return c.runTasks(append(tasks, checkTasks()...), depth)
+}
+
+// Run the tasks of a level by a pool of --concurrency workers, so no more than that many pages are fetched or
+// checked at once, however many URLs the level has, and return the URLs found on the pages that were not seen before
+func (c *crawlHistory) runTasks(tasks []crawlTask, depth int) []frontierURL {
+	// the queue of the level is not buffered, so the workers take the URLs in the order of their score
+	queue := make(chan crawlTask)
+	found := make(chan []frontierURL)
+
+	var workers sync.WaitGroup
+	for i := 0; i < min(max(*maxConcurrency, 1), len(tasks)); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for t := range queue {
+				if t.check {
+					c.Check(t.url)
+					continue
+				}
+				liveMetrics.queued.Add(-1)
+				found <- c.Crawl(t.url, depth)
+			}
+		}()
+	}
+
+	go func() {
+		for _, t := range tasks {
+			queue <- t
+		}
+		close(queue)
+		workers.Wait()
+		close(found)
+	}()
+
+	next := []frontierURL{}
+	for urls := range found {
+		next = append(next, urls...)
+
+		// the URLs at the maximal depth are never crawled, so they are not queued
+		if depth+1 < c.depth {
+			liveMetrics.queued.Add(int64(len(urls)))
+		}
+	}
+
+	return next
+}
+
+// Claim the slots for the URLs, which are sorted by their score, and return the URLs that got one, in the same order,
+// and the others. The start URL is always crawled, whatever max_urls says, but it takes a slot too.
+func claimURLs(urls []string) (claimed, unclaimed []string) {
+	start := normalizeURL(*startURL)
+	if slices.Contains(urls, start) {
+		countCrawled.Add(1)
+		claimed = append(claimed, start)
+	}
+
+	for _, u := range urls {
+		if u == start {
+			continue
+		}
+		if claimURL() {
+			claimed = append(claimed, u)
+		} else {
+			unclaimed = append(unclaimed, u)
+		}
+	}
+
+	return claimed, unclaimed
+}
+
+// Fetch the page at url with the context of the crawl, when the Fetcher takes one
+func (c *crawlHistory) fetch(url string) ([]string, error) {
+	if f, ok := c.Fetcher.(ContextFetcher); ok {
+		return f.FetchContext(abortContext(), url)
+	}
+	return c.Fetch(url)
+}
+
+// The depth at which every URL in the history was found, or nothing with --approx-dedup
+func (c *crawlHistory) depths() map[string]int {
+	m := <-c.mapAccess
+	c.mapAccess <- m
+
+	if depths, ok := m.(exactSet); ok {
+		return depths
+	}
+	return map[string]int{}
+}
+
+// The crawl function that is called by the workers for every URL at the given depth.
+// It returns the URLs found on the page that were not seen before.
+func (c *crawlHistory) Crawl(url string, depth int) []frontierURL {
+	if crawlAborted() != nil || hostStopped(url) {
+		return nil
+	}
+
+	if !robotsAllowed(url) {
+		robotsDisallowed.Add(1)
+		return nil
+	}
+	waitCrawlDelay(url)
+	done := waitHostTurn(url)
+
+	// the crawl may have been aborted while we waited our turn
+	if crawlAborted() != nil {
+		done()
+		return nil
+	}
+
+	urls, err := c.fetch(url)
+	done()
+	liveMetrics.page(depth, err)
+
+	// we don't care about error messages
+	// simply ignore website that we cannot visit
+	if err != nil {
+		return nil
+	}
+
+	next := []frontierURL{}
+
+	// request access to the history
+	m := <-c.mapAccess
+
+	// iterate over all urls that were in the body of the input url
+	for _, u := range urls {
+		// URLs that only differ in insignificant parts are the same page
+		u = normalizeURL(u)
+
+		if !linkInScope(u) {
+			queueChecks([]string{u})
+			continue
+		}
+
+		// with --seen-db, the URLs crawled by earlier runs are skipped as well
+		if seenURLs != nil && seenURLs.Seen(u) {
+			continue
+		}
+
+		if m.Add(u, depth+1) {
+			next = append(next, frontierURL{u, url})
+		}
+	}
+
+	// free the access token for the history
+	c.mapAccess <- m
+	uniqueURLs.Add(int64(len(next)))
+
+	return next
+}
+
+// Prepare the crawl from the options: parse the ones that need it, read the files they name and configure the client.
+// It also resets what an earlier crawl in this process left behind.
+func setup() error {
+	reset()
+
+	queryRules = parseQueryRules(*queryHosts)
+	startHost = siteHost(normalizeURL(*startURL))
+	startDomain = siteDomain(normalizeURL(*startURL))
+	if err := parseScopePatterns(); err != nil {
+		return err
+	}
+	defaultDocuments = nil
+	for _, doc := range strings.Split(*defaultDocumentsFlag, ",") {
+		if doc = strings.TrimSpace(doc); doc != "" {
+			defaultDocuments = append(defaultDocuments, doc)
+		}
+	}
+
+	anchorTextPattern = nil
+	if *anchorTextMatch != "" {
+		var err error
+		if anchorTextPattern, err = regexp.Compile(*anchorTextMatch); err != nil {
+			return fmt.Errorf("Invalid --anchor-text-match: %v", err)
+		}
+	}
+	contentSelector = nil
+	if *contentSelectorFlag != "" {
+		contentSelector = parseSelector(*contentSelectorFlag)
+	}
+
+	cfg = config{}
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadConfig(*configPath); err != nil {
+			return fmt.Errorf("Cannot read config file: %v", err)
+		}
+	}
+	if err := configureClient(); err != nil {
+		return err
+	}
+	if err := setupParsers(); err != nil {
+		return err
+	}
+	if err := setupExtractors(); err != nil {
+		return err
+	}
+	onPageSlots = make(chan bool, max(*onPageConcurrency, 1))
+
+	// --state is the directory of this crawl, --state-dir the directory with a directory for every --crawl-id
+	crawlStateDir = *statePath
+	if *stateDir != "" {
+		if *statePath != "" {
+			return fmt.Errorf("--state and --state-dir cannot be used together")
+		}
+		crawlStateDir = filepath.Join(*stateDir, *crawlID)
+	}
+
+	// the saved state needs every URL and every result, which these options do not keep
+	if crawlStateDir != "" && (*streamOutput != "" || *approxDedup) {
+		return fmt.Errorf("--state and --state-dir cannot be used together with --stream-output or --approx-dedup")
+	}
+
+	// a crawl in --state-dir is always resumed, but one in --state only with --resume, so it is not continued by accident
+	if *resume {
+		if crawlStateDir == "" {
+			return fmt.Errorf("--resume needs --state or --state-dir")
+		}
+		if !stateSaved(crawlStateDir) {
+			return fmt.Errorf("There is no saved crawl to resume in %s", crawlStateDir)
+		}
+	} else if *statePath != "" && stateSaved(*statePath) {
+		return fmt.Errorf("%s has the state of an earlier crawl: continue it with --resume, or remove it to start over", *statePath)
+	}
+
+	since = time.Time{}
+	if *sinceDate != "" {
+		var err error
+		if since, err = parseDate(*sinceDate); err != nil {
+			return fmt.Errorf("Invalid --since date: %v", err)
+		}
+	}
+
+	// read the earlier crawl before we start, since the file may be appended to by this one
+	previousTitles = nil
+	if *compareTitles != "" {
+		var err error
+		if previousTitles, err = loadPreviousTitles(*compareTitles); err != nil {
+			return fmt.Errorf("Cannot read --compare-titles file: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Main runs the gocrawler command line tool with the arguments, without the program name
+func Main(args []string) {
+	flags.Parse(args)
+	if err := setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// in verification mode we do not discover anything, we only check the listed URLs
+	if *verifyListPath != "" {
+		failed, err := verifyList(os.Stdout, *verifyListPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Cannot read URL list:", err)
+			os.Exit(1)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	switch *format {
+	case "text", "json", "csv", "sitemap":
+	default:
+		fmt.Fprintln(os.Stderr, "Invalid --format, it must be text, json, csv or sitemap:", *format)
+		os.Exit(1)
+	}
+	if *graphPath != "" && !slices.Contains(graphFormats, *graphFormat) {
+		fmt.Fprintln(os.Stderr, "Invalid --graph-format, it must be dot, graphml or jsonl:", *graphFormat)
+		os.Exit(1)
+	}
+
+	// before anything is printed or created, so a start URL that cannot be crawled does not leave an empty crawl behind
+	if *failFast {
+		if err := checkSeed(context.Background(), *startURL); err != nil {
+			fmt.Fprintln(os.Stderr, "Cannot crawl start URL:", err)
+			os.Exit(1)
+		}
+	}
+
+	// the crawl goes to stdout, unless --output-file is given. The other formats are meant for other tools,
+	// so then only the document goes to stdout and everything else we print goes to stderr
+	results := os.Stdout
+	console = os.Stdout
+	if *outputFile != "" {
+		var err error
+		if results, err = os.Create(*outputFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Cannot create output file:", err)
+			os.Exit(1)
+		}
+	} else if *format != "text" {
+		console = os.Stderr
+		commandOutput = os.Stderr
+	}
+
+	// and with --quiet the rest is not printed at all, but errors still go to stderr
+	if *quiet {
+		console = io.Discard
+	}
+
+	fmt.Fprintln(console, "====== Starting crawling...")
+	fmt.Fprintln(console, "=== Start URL: ", *startURL)
+	fmt.Fprintln(console, "=== Depth:     ", *depth)
+	fmt.Fprintln(console, "=== Max URLS:  ", *maxURLS)
+
+	seeds := []string{*startURL}
+
+	// with --progress, the statistics are printed every interval instead of the dots
+	if *progressInterval > 0 {
+		fmt.Fprintf(console, "=== Progress (every %v):\n", *progressInterval)
+	} else {
+		fmt.Fprintln(console, "=== Progress (1 dot is 1 URL found): ")
+	}
+
+	if *streamOutput != "" {
+		var err error
+		if stream, err = newStreamWriter(*streamOutput); err != nil {
+			fmt.Fprintln(os.Stderr, "Cannot create output file:", err)
+			os.Exit(1)
+		}
+	}
+
+	f := fetcher(make(map[string]*result, 10))
+
+	stats, graph, err := installReporters(results)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot create output file:", err)
+		os.Exit(1)
+	}
+
+	if *seenDB != "" {
+		var err error
+		if seenURLs, err = openSeenLog(*seenDB); err != nil {
+			fmt.Fprintln(os.Stderr, "Cannot open --seen-db:", err)
+			os.Exit(1)
+		}
+	}
+
+	// Ctrl-C and --max-duration abort the crawl, and the pages crawled until then are written as usual
+	ctx, cancel := crawlContext()
+	start := time.Now()
+
+	stopMetrics := func() {}
+	if *metricsAddr != "" {
+		var err error
+		if stopMetrics, err = serveMetrics(*metricsAddr); err != nil {
+			fmt.Fprintln(os.Stderr, "Cannot serve --metrics-addr:", err)
+			os.Exit(1)
+		}
+	}
+	stopProgress := func() {}
+	if *progressInterval > 0 {
+		stopProgress = printProgress(console, *progressInterval)
+	}
+
+	var depths map[string]int
+	if crawlStateDir != "" {
+		var err error
+		if depths, err = crawlWithState(ctx, crawlStateDir, seeds, *depth, f); err != nil {
+			fmt.Fprintln(os.Stderr, "\nCould not save or load the crawl state:", err)
+			os.Exit(1)
+		}
+	} else {
+		depths = Crawl(ctx, seeds, *depth, f)
+	}
+	elapsed := time.Since(start)
+	cancel()
+	stopProgress()
+	stopMetrics()
+
+	fmt.Fprintln(console, "\n==== Finished crawling!")
+
+	if seenURLs != nil {
+		if err := seenURLs.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not write --seen-db:", err)
+			os.Exit(1)
+		}
+	}
+
+	s := stats.Stats(elapsed)
+	if err := finishReporters(s, depths); err != nil {
+		fmt.Fprintln(os.Stderr, "Could not write the crawl:", err)
+		os.Exit(1)
+	}
+	if *outputFile != "" {
+		if err := results.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not write output file:", err)
+			os.Exit(1)
+		}
+	}
+	switch *output {
+	case "sqlite":
+		fmt.Fprintf(console, "Wrote %d pages to %s\n", s.Pages, *dbPath)
+	case "graphml":
+		fmt.Fprintf(console, "Wrote the link graph of %d pages to %s\n", s.Pages, *graphMLPath)
+	case "adjacency":
+		fmt.Fprintf(console, "Wrote the adjacency list of %d pages to %s\n", s.Pages, *adjacencyPath)
+	}
+
+	if graph != nil {
+		fmt.Fprintf(console, "Wrote the link graph of %d pages and %d links to %s\n", len(graph.pages), len(graph.edges), *graphPath)
+	}
+
+	// the pages crawled before the crawl was aborted are still written, but we exit with an error afterwards
+	if err := crawlAborted(); err != nil {
+		fmt.Fprintln(os.Stderr, "Crawl aborted:", err)
+		defer os.Exit(1)
+	}
+
+	// the results were written while crawling, so there is nothing left in memory to output
+	if stream != nil {
+		if err := stream.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not write output file:", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(console, "Wrote %d pages to %s\n", stream.count, *streamOutput)
+		if previousTitles != nil {
+			printTitleChanges()
+		}
+		return
+	}
+
+	switch *output {
+	case "urls", "sqlite", "graphml", "adjacency":
+		// the reporters wrote all there is to output
+	default:
+		// with --format=json they are in the JSON document
+		if *reportDuplicateTitles && *format != "json" {
+			printDuplicateTitles(f)
+		}
+		if *reportFrontier {
+			printFrontier(f, depths)
+		}
+		if *reportTLS {
+			printTLSReport(f)
+		}
+		if *reportMixedContent {
+			printMixedContent(f)
+		}
+		if *reportSelfLinks {
+			printSelfLinks(f)
+		}
+		if previousTitles != nil {
+			printTitleChanges()
+		}
+		if *maxRedirectReport > 0 {
+			printRedirectChains(f, *maxRedirectReport)
+		}
+		if *minCompressionRatio > 0 {
+			printCompressionReport(f, *minCompressionRatio)
+		}
+
+		// broken links make us exit with an error, like --verify-list does, so the check can fail a build
+		if *checkLinks && printBrokenLinks(f) > 0 {
+			defer os.Exit(1)
+		}
+	}
+}
+
+// A fetcher is a mapping from a URL to the relevant content that we have crawled
+type fetcher map[string]*result
+
+// The result stores the relevant content of a URL, which is its title and all links that occur in the body,
+// together with the HTTP status code of the response.
+// Pages that were not modified since --since are recorded as old, without following their links.
+// When fetching the page failed, err holds the reason. If that happened halfway, links holds the links read until then,
+// and truncated is set.
+// When the reason is a certificate problem, tlsError describes it.
+// Redirects holds the URLs the request was redirected through, ending with the URL of the final response.
+// Capped is set when the page has a rel="next" link that was not followed because of --max-pagination.
+// Size is the number of bytes read from the body of the page, and transferred the number of bytes that took
+// before decompression.
+// With --extract-media, media holds the URLs of the audio and video on the page, which are not crawled.
+// With --extract-images, images holds the images on the page, with every candidate of their srcset.
+// With --extract-headings, headings holds the h1-h6 headings in the order they appear on the page.
+// OpenGraph and twitter hold the Open Graph (og:*) and Twitter Card (twitter:*) meta properties of the page,
+// which make up its preview on social media. The og:title is also used as the title when the page has no <title>.
+// On HTTPS pages, mixedContent holds the resources (images, scripts, stylesheets, ...) the page loads over http://.
+// ContentType is the media type the server sent, and unparsed is set when there was no parser for it, so the page
+// was not read.
+// With --extract=meta, description and canonical hold the meta description and the canonical URL of the page,
+// and with --extract=assets, assets holds the URLs of the scripts, stylesheets and images it loads.
+type result struct {
+	title        string
+	links        []link
+	status       int
+	old          bool
+	err          error
+	tlsError     string
+	redirects    []string
+	size         int64
+	transferred  int64
+	capped       bool
+	media        []string
+	headings     []heading
+	openGraph    map[string]string
+	twitter      map[string]string
+	mixedContent []string
+	images       []image
+	truncated    bool
+	contentType  string
+	unparsed     bool
+	description  string
+	canonical    string
+	assets       []string
+}
+
+// A heading is the text of a h1-h6 element, with its level 1-6
+type heading struct {
+	level int
+	text  string
+}
+
+// A link is a URL found in an <a> tag, with the rel (e.g. nofollow, sponsored, ugc) and type attributes of the tag,
+// and the text of the link
+type link struct {
+	url  string
+	rel  string
+	typ  string
+	text string
+}
+
+// Fetchers store their results concurrently, so only the holder of this token may access the results map
+var resultsAccess = make(chan bool, 1)
+
+// Store the result for url, or with --stream-output write it out right away instead of keeping it in memory
+func (f fetcher) store(url string, r *result) {
+	checkTitle(url, r)
+	countTitle(url, r)
+
+	// with --seen-db, the pages that were fetched are not crawled again by later runs, but the ones that failed are
+	if seenURLs != nil && r.err == nil && r.status < 500 {
+		seenURLs.Add(url)
+	}
+	liveMetrics.bytes.Add(r.size)
+	liveMetrics.transferred.Add(r.transferred)
+
+	resultsAccess <- true
+	defer func() { <-resultsAccess }()
+
+	reportPage(url, r)
+
+	if stream != nil {
+		stream.write(url, r)
+		return
+	}
+
+	f[url] = r
+}
+
+// Fetch the page at url once, and return the URLs found in the body. See Fetch, which retries it.
+// When retry is true and the request times out or its connection is reset, the server answers with a 5xx status,
+// or the connection breaks while reading the page, it returns a retryError without storing the page, so it can be fetched again.
+// When crawl is done, the request is stopped, and the page is not stored either, so a resumed crawl fetches it.
+func (f fetcher) fetch(crawl context.Context, url string, retry bool) ([]string, error) {
+	// the deadline covers reading the body too, so a server that never finishes sending a page cannot hang us
+	ctx, cancel := context.WithTimeout(crawl, *timeout)
+	defer cancel()
+
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		f.store(url, &result{err: err})
+		return nil, err
+	}
+
+	// let the server tell us when the page did not change since --since
+	if !since.IsZero() {
+		req.Header.Set("If-Modified-Since", since.UTC().Format(http.TimeFormat))
+	}
+
+	// ask for a compressed page ourselves, so we can count the bytes before and after decompression
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	resp, err := client.Do(req)
+
+	if err != nil && crawl.Err() != nil {
+		return nil, err
+	}
+	if err != nil && retry && isTransient(err) {
+		return nil, &retryError{err}
+	}
+
+	// remember that we could not fetch the page, so it shows up with the errors
+	if err != nil {
+		f.store(url, &result{err: err, tlsError: tlsProblem(err)})
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if retry && resp.StatusCode >= 500 {
+		return nil, &retryError{fmt.Errorf("%s returned status %s", url, resp.Status)}
+	}
+
+	redirects := redirectChain(resp)
+
+	if !since.IsZero() && !modifiedSince(resp, since) {
+		f.store(url, &result{status: resp.StatusCode, old: true, redirects: redirects})
+		return nil, nil
+	}
+
+	// only read the pages there is a parser for, so we do not download images, PDFs, API responses and the like
+	// just to find that they have no links
+	mediaType := mediaTypeOf(resp)
+	parser := contentParsers[mediaType]
+	if parser == nil && !isHTML(mediaType) {
+		f.store(url, &result{status: resp.StatusCode, redirects: redirects, contentType: mediaType, unparsed: true})
+		return nil, nil
+	}
+
+	title := ""
+	urls := []string{}
+	links := []link{}
+	stylesheets := []string{}
+
+	// the position of this page in a chain of rel="next" links, and the next pages in the chain
+	chain := 0
+	next := []string{}
+	capped := false
+	if *maxPagination > 0 {
+		chain = paginationChain(url)
+	}
+
+	// the tag of the element that matches --content-selector, and how many elements with that tag deep we are inside
+	// it, 0 when we are outside of one. Only its own tag is counted, since other elements like <li> and <p> are often
+	// closed implicitly, without an end tag
+	contentTag := ""
+	inContent := 0
+
+	// the audio and video on the page, and how many <audio> and <video> elements we are in
+	media := []string{}
+	inMedia := 0
+
+	// the headings on the page, and the one we are reading the text of
+	headings := []heading{}
+	var inHeading *heading
+
+	// the images on the page
+	images := []image{}
+
+	// the meta description and the canonical URL of the page, and the scripts, stylesheets and images it loads
+	description := ""
+	canonical := ""
+	var assets []string
+	addAsset := func(u string) {
+		if !slices.Contains(assets, u) {
+			assets = append(assets, u)
+		}
+	}
+
+	// the URL of the page we ended up on after redirects, which relative links are resolved against
+	final := resp.Request.URL.String()
+
+	// and the URL they are resolved against, which the first <base href> on the page sets instead
+	base := final
+	baseSet := false
+
+	// the http:// resources on the page, when it is an HTTPS page
+	mixed := []string{}
+
+	// the Open Graph and Twitter Card properties of the page
+	openGraph := map[string]string{}
+	twitter := map[string]string{}
+
+	raw, body, err := decodeBody(resp)
+	if err != nil {
+		f.store(url, &result{status: resp.StatusCode, err: err, redirects: redirects})
+		return nil, err
+	}
+
+	// never read more than max-body-size bytes from a page. We cannot rely on the Content-Length for this,
+	// since chunked responses do not have one, so instead the body is cut off while it is streamed.
+	// The limit applies to the decompressed page, so a small compressed body cannot blow up either
+	b := &countingReader{r: io.LimitReader(body, *maxBodySize)}
+
+	// code for HTML parsing
+	// from: http://schier.co/blog/2015/04/26/a-simple-web-scraper-in-go.html
+	// only I added the parsing of the title of the URL
+	// keep a copy of the page for the --on-page command
+	var page bytes.Buffer
+	var r io.Reader = b
+	if *onPage != "" {
+		r = io.TeeReader(b, &page)
+	}
+	z := html.NewTokenizer(r)
+
+	// add a link to the page, and follow it unless one of the options says otherwise
+	addLink := func(l link) {
+		// local files may link to other local files, but web pages may not
+		u := l.url
+		if strings.HasPrefix(u, "file://") && !strings.HasPrefix(url, "file://") {
+			return
+		}
+		printDot()
+		links = append(links, l)
+
+		// files like PDFs are recorded, and checked with --check-links, but not crawled
+		if isFile(u) {
+			return
+		}
+
+		// with --anchor-text-match, links whose text does not match are recorded but not followed
+		if anchorTextPattern != nil && !anchorTextPattern.MatchString(l.text) {
+			return
+		}
+
+		// and with --respect-nofollow for links the page asks us not to follow
+		if *respectNofollow && hasRel(l, "nofollow") {
+			return
+		}
+
+		// the same goes for links outside of the directory of the page with --same-directory
+		if *sameDirectory && !inDirectory(url, u) {
+			return
+		}
+
+		// and for links outside of the scope of the crawl, which would only use up max_urls
+		if !linkInScope(normalizeURL(u)) {
+			return
+		}
+
+		// follow pagination, but not further than --max-pagination pages
+		isNext := *maxPagination > 0 && hasRel(l, "next")
+		if isNext && chain >= *maxPagination {
+			capped = true
+			return
+		}
+
+		if isNext {
+			next = append(next, u)
+		}
+		urls = append(urls, u)
+	}
+
+	// the <a> we are in, which is added when we have read its text
+	var anchor *link
+	addAnchor := func() {
+		if anchor == nil {
+			return
+		}
+
+		l := *anchor
+		l.text = strings.Join(strings.Fields(l.text), " ")
+		anchor = nil
+
+		addLink(l)
+	}
+
+	// a page with a parser of its own only has links
+	done := false
+	if parser != nil {
+		found, err := parser.Parse(final, r)
+		if err != nil {
+			f.store(url, &result{status: resp.StatusCode, err: err, redirects: redirects, size: b.n, transferred: raw.n,
+				contentType: mediaType})
+			return nil, err
+		}
+
+		for _, l := range found {
+			u, ok := resolve(final, l.URL)
+			if !ok || !(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "file://")) {
+				continue
+			}
+			addLink(link{url: u, rel: l.Rel, typ: l.Type, text: l.Text})
+		}
+		done = true
+	}
+
+	for !done {
+		tt := z.Next()
+
+		switch tt {
+		case html.ErrorToken:
+			// anything else than the end of the body means the connection broke while we read the page. We do not
+			// follow the links we found so far
+			if err := z.Err(); err != io.EOF {
+				if crawl.Err() != nil {
+					return nil, err
+				}
+				if retry {
+					return nil, &retryError{err}
+				}
+				f.store(url, &result{title: title, links: links, status: resp.StatusCode, err: err, redirects: redirects,
+					size: b.n, transferred: raw.n, truncated: true})
+				return nil, err
+			}
+			addAnchor()
+			done = true
+		case html.TextToken:
+			if anchor != nil {
+				anchor.text += string(z.Text())
+			}
+			if inHeading != nil {
+				inHeading.text += string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if inContent > 0 && string(name) == contentTag {
+				inContent--
+			}
+
+			if inMedia > 0 && (string(name) == "audio" || string(name) == "video") {
+				inMedia--
+			}
+			if string(name) == "a" {
+				addAnchor()
+			}
+			if inHeading != nil && headingLevel(string(name)) == inHeading.level {
+				inHeading.text = strings.Join(strings.Fields(inHeading.text), " ")
+				headings = append(headings, *inHeading)
+				inHeading = nil
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+
+			mixed = append(mixed, mixedContent(base, t)...)
+			if extracting("images") {
+				images = append(images, imagesOf(base, t)...)
+			}
+
+			if contentSelector != nil && tt == html.StartTagToken && !voidElements[t.Data] {
+				if inContent > 0 && t.Data == contentTag {
+					inContent++
+				} else if inContent == 0 && contentSelector.matches(t) {
+					contentTag = t.Data
+					inContent = 1
+				}
+			}
+
+			switch t.Data {
+			case "a":
+				ok, l := getHref(base, t)
+				if !ok {
+					continue
+				}
+
+				// with --content-selector, links outside of the selected element are ignored
+				if contentSelector != nil && inContent == 0 {
+					continue
+				}
+
+				// an <a> is closed implicitly by the next one
+				addAnchor()
+				anchor = &l
+			case "base":
+				for _, a := range t.Attr {
+					if a.Key == "href" && !baseSet {
+						if u, ok := resolve(final, a.Val); ok {
+							base = u
+							baseSet = true
+						}
+					}
+				}
+			case "title":
+				if ttt := z.Next(); ttt == html.TextToken {
+					title = cleanTitle(z.Token().Data)
+				}
+			case "meta":
+				addSocialMeta(t, openGraph, twitter)
+				if extracting("meta") && description == "" {
+					description = metaDescription(t)
+				}
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				if extracting("headings") && tt == html.StartTagToken {
+					inHeading = &heading{level: headingLevel(t.Data)}
+				}
+			case "audio", "video", "source":
+				if !extracting("media") {
+					continue
+				}
+
+				if t.Data != "source" && tt == html.StartTagToken {
+					inMedia++
+				}
+
+				// <source> is also used for the images in <picture>, which are not media
+				if t.Data == "source" && inMedia == 0 {
+					continue
+				}
+
+				for _, a := range t.Attr {
+					if a.Key == "src" {
+						if u, ok := resolve(base, a.Val); ok {
+							media = append(media, u)
+						}
+					}
+				}
+			case "link":
+				ok, l := getHref(base, t)
+				if !ok {
+					continue
+				}
+
+				if extracting("meta") && canonical == "" && hasRel(l, "canonical") {
+					canonical = l.url
+				}
+				if hasRel(l, "stylesheet") {
+					if extracting("assets") {
+						addAsset(l.url)
+					}
+					if *parseCSS {
+						stylesheets = append(stylesheets, l.url)
+					}
+				}
+			case "script", "img":
+				if !extracting("assets") {
+					continue
+				}
+
+				for _, a := range t.Attr {
+					if a.Key == "src" && !strings.HasPrefix(strings.TrimSpace(a.Val), "data:") {
+						if u, ok := resolve(base, a.Val); ok {
+							addAsset(u)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// read the stylesheets after the page, so we do not keep the page connection open meanwhile. The pages they refer
+	// to are links of the page, so the same options decide whether they are followed
+	for _, css := range stylesheets {
+		for _, u := range cssLinks(css) {
+			addLink(link{url: u})
+		}
+	}
+
+	if len(next) > 0 {
+		recordNext(chain, next)
+	}
+
+	// pages without a <title> often still have a title for social media
+	if title == "" && openGraph["og:title"] != "" {
+		title = cleanTitle(openGraph["og:title"])
+	}
+
+	if *onPage != "" {
+		if err := runOnPage(url, page.Bytes()); err != nil {
+			fmt.Fprintln(os.Stderr, "\n"+err.Error())
+			if *onPageAbort {
+				abortCrawl(err)
+			}
+		}
+	}
+
+	// the links that are not followed are checked with --check-links
+	if *checkLinks {
+		followed := map[string]bool{}
+		for _, u := range urls {
+			followed[u] = true
+		}
+		for _, l := range links {
+			if !followed[l.url] {
+				queueChecks([]string{normalizeURL(l.url)})
+			}
+		}
+	}
+
+	// store the result in the fetcher
+	f.store(url, &result{title: title, links: links, status: resp.StatusCode, capped: capped, media: media,
+		headings: headings, redirects: redirects, size: b.n, transferred: raw.n, openGraph: openGraph,
+		twitter: twitter, mixedContent: mixed, images: images, contentType: mediaType, description: description,
+		canonical: canonical, assets: assets})
+
+	return urls, nil
+}
+
+// retrieve the URL from a <a href="..."> token, together with its rel and type attributes.
+// Relative URLs are resolved against the URL of the page, base. Only links to other pages are returned,
+// so links to a #section of the page itself, and mailto:, javascript: etc. links are not.
+// from http://schier.co/blog/2015/04/26/a-simple-web-scraper-in-go.html
+func getHref(base string, t html.Token) (ok bool, l link) {
+	href := ""
+	for _, a := range t.Attr {
+		switch a.Key {
+		case "href":
+			href = strings.TrimSpace(a.Val)
+			ok = true
+		case "rel":
+			l.rel = a.Val
+		case "type":
+			l.typ = a.Val
+		}
+	}
+
+	if !ok || href == "" || strings.HasPrefix(href, "#") {
+		return false, l
+	}
+
+	u, ok := resolve(base, href)
+	lower := strings.ToLower(u)
+	if !ok || !(strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "file://")) {
+		return false, l
+	}
+
+	// the fragment is a place on the page, the page itself is the same
+	if i := strings.Index(u, "#"); i >= 0 {
+		u = u[:i]
+	}
+	l.url = u
+
+	return true, l
+}
+
+// The level of a heading element, e.g. 2 for h2, or 0 for anything else
+func headingLevel(tag string) int {
+	if len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6' {
+		return int(tag[1] - '0')
+	}
+
+	return 0
+}
+
+// Collapse the whitespace in a title, which often spans several indented lines in the source,
+// and truncate it with an ellipsis when it is longer than --title-max-len
+func cleanTitle(title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+
+	if r := []rune(title); *titleMaxLen > 0 && len(r) > *titleMaxLen {
+		title = string(r[:*titleMaxLen]) + "…"
+	}
+
+	return title
+}
+
+// Whether the page in the response was modified after t. Servers that do not support conditional requests
+// still send the page, so then we look at its Last-Modified header. Pages without one count as modified.
+func modifiedSince(resp *http.Response, t time.Time) bool {
+	if resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		return lm.After(t)
+	}
+
+	return true
+}
+
+// Parse a date given on the command line, either as 2006-01-02 or in RFC 3339 format
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+func isFile(url string) bool {
+	files := []string{".pdf", ".zip", ".jpeg", ".jpg", ".gif", ".png", ".doc", ".docx", ".rar", ".gzip", ".tar", ".mp3",
+		".wav", ".mpg", ".mpeg", ".swf", ".exe", ".bin"}
+
+	for _, file := range files {
+		if strings.HasSuffix(url, file) {
+			return true
+		}
+	}
+
+	return false
+}
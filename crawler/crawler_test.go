@@ -0,0 +1,2611 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Crawl from start with the config, and fail the test when that is not possible
+func crawlWith(t *testing.T, config Config, start string) *Result {
+	t.Helper()
+
+	c, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Run(context.Background(), start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestRedirectToFile(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret.html")
+	if err := os.WriteFile(secret, []byte("<title>TOP SECRET</title>"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/secret" {
+			http.Redirect(w, r, "file://"+secret, http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, `<a href="/secret">secret</a>`)
+	}))
+	defer srv.Close()
+
+	result := crawlWith(t, Config{}, srv.URL+"/")
+
+	p, ok := result.Pages[srv.URL+"/secret"]
+	if !ok {
+		t.Fatalf("/secret was not crawled: %v", result.Pages)
+	}
+	if strings.Contains(p.Title, "SECRET") || p.Err == nil {
+		t.Errorf("the redirect to a local file was followed: title %q, error %v", p.Title, p.Err)
+	}
+}
+
+// A Reporter that remembers what it got
+type recordingReporter struct {
+	pages []string
+	stats *Stats
+}
+
+func (r *recordingReporter) Page(url string, p Page) {
+	r.pages = append(r.pages, url)
+}
+
+func (r *recordingReporter) Finish(s Stats) {
+	r.stats = &s
+}
+
+func TestCustomReporter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a>`)
+	}))
+	defer srv.Close()
+
+	reporter := &recordingReporter{}
+	result := crawlWith(t, Config{Reporters: []Reporter{reporter}}, srv.URL+"/")
+
+	if len(reporter.pages) != len(result.Pages) || len(reporter.pages) != 3 {
+		t.Errorf("the reporter got %v, the result has %d pages", reporter.pages, len(result.Pages))
+	}
+	for _, url := range reporter.pages {
+		if _, ok := result.Pages[url]; !ok {
+			t.Errorf("the reporter got %s, which is not in the result", url)
+		}
+	}
+	if reporter.stats == nil || reporter.stats.Pages != 3 {
+		t.Errorf("the reporter got the stats %+v, want 3 pages", reporter.stats)
+	}
+}
+
+func TestCustomScore(t *testing.T) {
+	var fetched []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/product/1">1</a><a href="/b">b</a><a href="/product/2">2</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	products := func(url string, depth int, referrer string) float64 {
+		if strings.Contains(url, "product") {
+			return 1
+		}
+		return 0
+	}
+
+	// one worker fetches the URLs in the order of their score
+	options := map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false"}
+	result := crawlWith(t, Config{Concurrency: 1, Score: products, Options: options}, srv.URL+"/")
+	if want := "[/ /product/1 /product/2 /a /b]"; fmt.Sprint(fetched) != want {
+		t.Errorf("fetched %v, want %s", fetched, want)
+	}
+	if len(result.Pages) != 5 {
+		t.Errorf("crawled %d pages, want 5", len(result.Pages))
+	}
+
+	// and when max_urls does not leave room for all of them, the best scoring URLs get the slots
+	fetched = nil
+	result = crawlWith(t, Config{MaxURLs: 3, Score: products, Options: options}, srv.URL+"/")
+	for _, path := range []string{"/", "/product/1", "/product/2"} {
+		if _, ok := result.Pages[srv.URL+path]; !ok {
+			t.Errorf("%s was not crawled", path)
+		}
+	}
+	if len(result.Pages) != 3 {
+		t.Errorf("crawled %d pages, want 3: %v", len(result.Pages), fetched)
+	}
+
+	// the Score gets the page every URL was found on, and nothing for the start URL
+	referrers := map[string]string{}
+	byReferrer := func(url string, depth int, referrer string) float64 {
+		referrers[url] = referrer
+		return 0
+	}
+	crawlWith(t, Config{Score: byReferrer, Options: options}, srv.URL+"/")
+	if referrers[srv.URL+"/"] != "" || referrers[srv.URL+"/product/1"] != srv.URL+"/" {
+		t.Errorf("got the referrers %v, want %s for the links on the start URL", referrers, srv.URL+"/")
+	}
+}
+
+func TestExportLinkAttributes(t *testing.T) {
+	f := fetcher{"https://example.com/": &result{title: "Home", status: 200, links: []link{
+		{url: "https://example.com/a", text: "a"},
+		{url: "https://other.example/", rel: "nofollow sponsored", typ: "text/html", text: "ad"},
+	}}}
+	depths := map[string]int{"https://example.com/": 0}
+
+	var b bytes.Buffer
+	if err := exportResults(&b, "json", f, depths, Stats{}); err != nil {
+		t.Fatal(err)
+	}
+	var doc jsonCrawl
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	want := jsonLink{"https://other.example/", "nofollow sponsored", "text/html", "ad"}
+	if links := doc.Results["https://example.com/"].Links; len(links) != 2 || links[1] != want {
+		t.Errorf("got the links %+v, want the second to be %+v", links, want)
+	}
+
+	b.Reset()
+	if err := exportResults(&b, "csv", f, depths, Stats{}); err != nil {
+		t.Fatal(err)
+	}
+	csv := "url,title,status,depth,parent,links,rels,types\n" +
+		"https://example.com/,Home,200,0,,https://example.com/a https://other.example/,|nofollow sponsored,|text/html\n"
+	if b.String() != csv {
+		t.Errorf("got the CSV\n%s\nwant\n%s", b.String(), csv)
+	}
+}
+
+func TestExportSocialMeta(t *testing.T) {
+	f := fetcher{"https://example.com/": &result{title: "Home", status: 200,
+		openGraph: map[string]string{"og:title": "Home", "og:image": "https://example.com/home.png"},
+		twitter:   map[string]string{"twitter:card": "summary"}}}
+
+	var b bytes.Buffer
+	if err := exportResults(&b, "json", f, map[string]int{"https://example.com/": 0}, Stats{}); err != nil {
+		t.Fatal(err)
+	}
+	var doc jsonCrawl
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	p := doc.Results["https://example.com/"]
+	if p.OpenGraph["og:image"] != "https://example.com/home.png" || p.Twitter["twitter:card"] != "summary" {
+		t.Errorf("got the Open Graph properties %v and the Twitter Card properties %v", p.OpenGraph, p.Twitter)
+	}
+}
+
+func TestExportDuplicateTitles(t *testing.T) {
+	f := fetcher{
+		"https://example.com/":  &result{title: "Home", status: 200},
+		"https://example.com/a": &result{title: " home ", status: 200},
+		"https://example.com/b": &result{title: "B", status: 200},
+	}
+
+	*reportDuplicateTitles = true
+	defer func() { *reportDuplicateTitles = false }()
+
+	var b bytes.Buffer
+	if err := exportResults(&b, "json", f, map[string]int{}, Stats{}); err != nil {
+		t.Fatal(err)
+	}
+	var doc jsonCrawl
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if want := "map[home:[https://example.com/ https://example.com/a]]"; fmt.Sprint(doc.DuplicateTitles) != want {
+		t.Errorf("got the duplicate titles %v, want %s", doc.DuplicateTitles, want)
+	}
+}
+
+func TestFrontierOfMaxURLs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a><a href="/c">c</a><a href="/d">d</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	crawl := crawlWith(t, Config{MaxURLs: 3, Options: map[string]string{"respect_robots": "false"}}, srv.URL+"/")
+
+	f := fetcher{}
+	for url := range crawl.Pages {
+		f[url] = &result{}
+	}
+	urls := frontier(f, crawl.Depths)
+	if len(crawl.Pages) != 3 || len(urls) != 2 {
+		t.Fatalf("crawled %d pages with a frontier of %v, want 3 pages and 2 URLs", len(crawl.Pages), urls)
+	}
+	for _, url := range urls {
+		if crawl.Depths[url] != 1 {
+			t.Errorf("%s is in the frontier at depth %d, want 1", url, crawl.Depths[url])
+		}
+	}
+}
+
+// Cancel a crawl of a site whose robots.txt or the options make every page wait for its turn, and fail the test
+// when the crawl keeps waiting
+func testCancelWhileWaiting(t *testing.T, robots string, options map[string]string) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, robots)
+			return
+		}
+		fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a>`)
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{Options: options})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	began := time.Now()
+	result, err := c.Run(ctx, srv.URL+"/")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got the error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if took := time.Since(began); took > 5*time.Second {
+		t.Errorf("the crawl took %v after it was cancelled", took)
+	}
+	if _, ok := result.Pages[srv.URL+"/"]; !ok {
+		t.Errorf("the start URL was not crawled before the crawl was cancelled")
+	}
+}
+
+func TestCancelDuringCrawlDelay(t *testing.T) {
+	testCancelWhileWaiting(t, "User-agent: *\nCrawl-delay: 60\n", nil)
+}
+
+func TestCancelDuringDelay(t *testing.T) {
+	testCancelWhileWaiting(t, "", map[string]string{"delay": "1m"})
+}
+
+func TestCancelDuringRetry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/down">down</a>`)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{Options: map[string]string{"retries": "20", "respect_robots": "false"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	began := time.Now()
+	if _, err := c.Run(ctx, srv.URL+"/"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got the error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if took := time.Since(began); took > 5*time.Second {
+		t.Errorf("the crawl took %v after it was cancelled", took)
+	}
+}
+
+// A Reporter that calls a function for every page
+type reporterFunc func(url string, p Page)
+
+func (f reporterFunc) Page(url string, p Page) { f(url, p) }
+func (f reporterFunc) Finish(Stats)            {}
+
+func TestResumeCrawl(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fetched := map[string]int{}
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first run stops the requests it made after it was interrupted, which are not answered
+		if ctx.Err() != nil && r.URL.Path != "/" && r.URL.Path != "/a" && r.Header.Get("X-Run") == "" {
+			<-r.Context().Done()
+			return
+		}
+
+		mu.Lock()
+		fetched[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a><a href="/c">c</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	// interrupt the first run when it has crawled the first page after the start URL
+	interrupt := reporterFunc(func(url string, p Page) {
+		if url == srv.URL+"/a" {
+			cancel()
+		}
+	})
+	state := t.TempDir()
+	config := Config{Concurrency: 1, MaxURLs: 4, Reporters: []Reporter{interrupt}, Options: map[string]string{
+		"state-dir": state, "crawl-id": "resumed", "respect_robots": "false", "fail-fast-on-seed": "false",
+	}}
+	c, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := c.Run(ctx, srv.URL+"/")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got the error %v, want %v", err, context.Canceled)
+	}
+	if len(result.Pages) != 2 {
+		t.Fatalf("the first run crawled %d pages, want 2", len(result.Pages))
+	}
+
+	// the second run crawls the rest, and the pages of the first run take their max_urls slots without being fetched
+	config.Reporters = nil
+	config.Headers = map[string]string{"X-Run": "2"}
+	result = crawlWith(t, config, srv.URL+"/")
+	if len(result.Pages) != 4 {
+		t.Errorf("the resumed crawl has %d pages, want 4", len(result.Pages))
+	}
+	for _, path := range []string{"/", "/a", "/b", "/c"} {
+		if fetched[path] != 1 {
+			t.Errorf("%s was fetched %d times, want 1", path, fetched[path])
+		}
+	}
+}
+
+// A ContextFetcher that waits for the context of the crawl, and remembers why it was done
+type waitingFetcher struct {
+	err chan error
+}
+
+func (w waitingFetcher) Fetch(url string) ([]string, error) {
+	return nil, fmt.Errorf("Fetch was called instead of FetchContext")
+}
+
+func (w waitingFetcher) FetchContext(ctx context.Context, url string) ([]string, error) {
+	<-ctx.Done()
+	w.err <- context.Cause(ctx)
+	return nil, ctx.Err()
+}
+
+func TestCancelStopsRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Minute):
+		}
+	}))
+	defer srv.Close()
+
+	// a request that is being made is stopped, it does not run until --timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	c, err := New(Config{Timeout: time.Minute, Options: map[string]string{"respect_robots": "false"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	began := time.Now()
+	result, err := c.Run(ctx, srv.URL+"/")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got the error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if took := time.Since(began); took > 5*time.Second {
+		t.Errorf("the crawl took %v after it was cancelled", took)
+	}
+	if len(result.Pages) != 0 {
+		t.Errorf("the page whose request was stopped was recorded: %v", result.Pages)
+	}
+
+	// and a custom Fetcher sees it too
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	fetcher := waitingFetcher{make(chan error, 1)}
+	if c, err = New(Config{Fetcher: fetcher, Options: map[string]string{"respect_robots": "false"}}); err != nil {
+		t.Fatal(err)
+	}
+	c.Run(ctx, "https://example.com/")
+	if err := <-fetcher.err; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("the fetcher got the context done with %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	heads := map[string]int{}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		if r.Method == http.MethodHead {
+			heads[r.URL.Path]++
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		// the links to localhost are to another host than the start URL on 127.0.0.1, so they are checked
+		other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(w, `<a href="%s/gone/%d">%d</a>`, other, i, i)
+		}
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	c, err := New(Config{Concurrency: 2, SameHost: true, Fetcher: f,
+		Options: map[string]string{"check-links": "true", "respect_robots": "false"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Run(context.Background(), srv.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if maxInFlight > 2 {
+		t.Errorf("%d requests were made at the same time, want at most 2", maxInFlight)
+	}
+	if len(heads) != 10 {
+		t.Errorf("got HEAD requests for %v, want one for each of the 10 links", heads)
+	}
+	if links := brokenLinks(f)[srv.URL+"/"]; len(links) != 10 {
+		t.Errorf("got the broken links %v, want 10", links)
+	}
+}
+
+func TestCheckFileLinks(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path] += r.Method + " "
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><a href="/report.pdf">Report</a><a href="/gone.pdf">Old report</a>`)
+		case "/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	c, err := New(Config{Depth: 3, Fetcher: f, Options: map[string]string{"check-links": "true", "respect_robots": "false"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Run(context.Background(), srv.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the files are links of the page, which are checked but not crawled
+	if got := len(f[srv.URL+"/"].links); got != 2 {
+		t.Errorf("recorded %d links, want the 2 links to PDFs", got)
+	}
+	if requests["/report.pdf"] != "HEAD " || requests["/gone.pdf"] != "HEAD " {
+		t.Errorf("got the requests %v, want only a HEAD request for each PDF", requests)
+	}
+	if links := brokenLinks(f)[srv.URL+"/"]; len(links) != 1 || links[0].target != srv.URL+"/gone.pdf" {
+		t.Errorf("got the broken links %v, want /gone.pdf", links)
+	}
+}
+
+func TestQueryRulePathPrefix(t *testing.T) {
+	queryRules = parseQueryRules("example.com/search")
+	defer func() { queryRules = nil }()
+
+	for u, want := range map[string]string{
+		"https://example.com/search?q=go":       "https://example.com/search?q=go",
+		"https://example.com/search/books?q=go": "https://example.com/search/books?q=go",
+		"https://example.com/searchable?q=go":   "https://example.com/searchable",
+		"https://example.com/?q=go":             "https://example.com/",
+	} {
+		if got := normalizeURL(u); got != want {
+			t.Errorf("normalizeURL(%s) = %s, want %s", u, got, want)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	queryRules = parseQueryRules("Example.com/search")
+	defer func() { queryRules = nil }()
+
+	for u, want := range map[string]string{
+		"http://example.com":                   "http://example.com/",
+		"http://example.com/":                  "http://example.com/",
+		"http://example.com/#top":              "http://example.com/",
+		"HTTP://Example.COM/docs/":             "http://example.com/docs",
+		"http://example.com/docs#intro":        "http://example.com/docs",
+		"http://example.com/docs//":            "http://example.com/docs",
+		"http://example.com:80/Docs/":          "http://example.com/Docs",
+		"http://example.com:8080/search/?q=go": "http://example.com:8080/search?q=go",
+		"http://example.com:8080/other?q=go":   "http://example.com:8080/other",
+	} {
+		if got := normalizeURL(u); got != want {
+			t.Errorf("normalizeURL(%s) = %s, want %s", u, got, want)
+		}
+	}
+
+	*normalizeTrailingSlash = false
+	defer func() { *normalizeTrailingSlash = true }()
+	if got := normalizeURL("http://example.com/docs/"); got != "http://example.com/docs/" {
+		t.Errorf("normalizeURL kept the trailing slash as %s with --normalize-trailing-slash=false", got)
+	}
+}
+
+func TestNormalizedURLsCrawledOnce(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		fmt.Fprint(w, `<html><a href="/docs">a</a><a href="/docs/">b</a><a href="/docs/#top">c</a><a href="/#top">d</a>`)
+	}))
+	defer srv.Close()
+
+	result := crawlWith(t, Config{Depth: 3, Options: map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false"}},
+		strings.ToUpper(srv.URL[:4])+srv.URL[4:])
+	if requests["/"] != 1 || requests["/docs"] != 1 || len(requests) != 2 {
+		t.Errorf("got the requests %v, want one for / and one for /docs", requests)
+	}
+	if result.Stats.Pages != 2 {
+		t.Errorf("crawled %d pages, want 2", result.Stats.Pages)
+	}
+}
+
+func TestStreamAppend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><title>Home</title>`)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "crawl.jsonl")
+	options := map[string]string{"respect_robots": "false", "stream-output": path, "stream-append": "true"}
+	crawlWith(t, Config{Options: options}, srv.URL+"/")
+	crawlWith(t, Config{Options: options}, srv.URL+"/")
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var page jsonPage
+		if err := json.Unmarshal([]byte(line), &page); err != nil {
+			t.Fatal(err)
+		}
+		if page.Time.IsZero() {
+			t.Errorf("the page %s of run %s has no time", page.URL, page.Run)
+		}
+		runs[page.Run] = true
+	}
+	if len(runs) != 2 {
+		t.Errorf("got the runs %v in the file, want the pages of both crawls", runs)
+	}
+}
+
+func TestRunIDPerCrawl(t *testing.T) {
+	r := &result{title: "Home", status: 200}
+
+	reset()
+	first := newJSONPage("https://example.com/", r)
+	reset()
+	second := newJSONPage("https://example.com/", r)
+
+	if first.Run == "" || first.Run == second.Run {
+		t.Errorf("two crawls have the run IDs %q and %q, want two different ones", first.Run, second.Run)
+	}
+}
+
+// A Fetcher with a fixed link graph, which counts the pages it fetched, and how many it fetched at once
+type stubFetcher struct {
+	links map[string][]string
+
+	sync.Mutex
+	fetched               int
+	urls                  []string
+	inFlight, maxInFlight int
+}
+
+func (s *stubFetcher) Fetch(url string) ([]string, error) {
+	s.Lock()
+	s.fetched++
+	s.urls = append(s.urls, url)
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.Unlock()
+
+	// take some time, so the other workers start their fetches meanwhile
+	time.Sleep(time.Millisecond)
+
+	s.Lock()
+	s.inFlight--
+	s.Unlock()
+
+	return s.links[url], nil
+}
+
+// A site where the start URL links to 30 pages, which link to 10 pages each
+func newStubFetcher() *stubFetcher {
+	s := &stubFetcher{links: map[string][]string{}}
+	for i := 0; i < 30; i++ {
+		page := fmt.Sprintf("https://example.com/%d", i)
+		s.links["https://example.com/"] = append(s.links["https://example.com/"], page)
+		for j := 0; j < 10; j++ {
+			s.links[page] = append(s.links[page], fmt.Sprintf("%s/%d", page, j))
+		}
+	}
+
+	return s
+}
+
+func TestMaxURLsIsStable(t *testing.T) {
+	found := -1
+	for run := 0; run < 5; run++ {
+		s := newStubFetcher()
+		result := crawlWith(t, Config{Depth: 3, MaxURLs: 100, Fetcher: s,
+			Options: map[string]string{"respect_robots": "false"}}, "https://example.com/")
+
+		if s.fetched != 100 {
+			t.Errorf("run %d fetched %d pages, want 100", run, s.fetched)
+		}
+		if found != -1 && len(result.Depths) != found {
+			t.Errorf("run %d found %d unique URLs, the run before %d", run, len(result.Depths), found)
+		}
+		found = len(result.Depths)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	for _, limit := range []int{1, 4, 16} {
+		s := newStubFetcher()
+		crawlWith(t, Config{Depth: 3, MaxURLs: 1000, Concurrency: limit, Fetcher: s,
+			Options: map[string]string{"respect_robots": "false"}}, "https://example.com/")
+
+		if s.fetched != 331 {
+			t.Errorf("fetched %d pages with --max_concurrency=%d, want 331", s.fetched, limit)
+		}
+		if s.maxInFlight > limit {
+			t.Errorf("fetched %d pages at once with --max_concurrency=%d", s.maxInFlight, limit)
+		}
+	}
+}
+
+func TestSQLiteRowCounts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<title>Home</title><a href="/a">a</a><a href="/b">b</a><a href="https://other.example/">other</a>`)
+		case "/a":
+			fmt.Fprint(w, `<title>A</title><a href="/">home</a>`)
+		default:
+			fmt.Fprint(w, `<title>B</title>`)
+		}
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	result := crawlWith(t, Config{SameHost: true, Fetcher: f, Options: map[string]string{"respect_robots": "false"}},
+		srv.URL+"/")
+
+	path := filepath.Join(t.TempDir(), "crawl.db")
+	sqlite, err := newSQLiteReporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reportAll(sqlite, f, result.Depths); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for table, want := range map[string]int{"pages": 3, "links": 4} {
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Errorf("the %s table has %d rows, want %d", table, n, want)
+		}
+	}
+
+	var depth int
+	if err := db.QueryRow(`SELECT depth FROM pages WHERE title = 'A'`).Scan(&depth); err != nil || depth != 1 {
+		t.Errorf("the depth of /a is %d (%v), want 1", depth, err)
+	}
+}
+
+// Send the pages of f to the reporter, and finish it with the depths
+func reportAll(rep pageReporter, f fetcher, depths map[string]int) error {
+	for _, url := range f.sortedURLs() {
+		rep.Page(url, f[url])
+	}
+	return rep.Finish(Stats{}, depths)
+}
+
+// A file that counts the write calls made to it, which are write syscalls for a real file
+type countingFile struct {
+	writes int
+}
+
+func (c *countingFile) Write(p []byte) (int, error) {
+	c.writes++
+	return len(p), nil
+}
+
+func (c *countingFile) Close() error { return nil }
+
+// Compare the write calls of writing every page to --stream-output as it comes in with those of the buffered stream.
+// Run it with go test -bench=StreamWrites -run=^$ ./crawler and compare the writes/page.
+func BenchmarkStreamWrites(b *testing.B) {
+	r := &result{title: "A page", status: 200, links: []link{{url: "https://example.com/a"}, {url: "https://example.com/b"}}}
+
+	b.Run("per-page", func(b *testing.B) {
+		file := &countingFile{}
+		enc := json.NewEncoder(file)
+		for i := 0; i < b.N; i++ {
+			enc.Encode(newJSONPage("https://example.com/", r))
+		}
+		b.ReportMetric(float64(file.writes)/float64(b.N), "writes/page")
+	})
+
+	b.Run("flush-interval", func(b *testing.B) {
+		file := &countingFile{}
+		s := newStream(file)
+		for i := 0; i < b.N; i++ {
+			s.write("https://example.com/", r)
+		}
+		if err := s.Close(); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportMetric(float64(file.writes)/float64(b.N), "writes/page")
+	})
+}
+
+// Compare the heap that is still in use after storing the pages of a large crawl in memory with that of
+// --stream-output, which stays flat however many pages there are.
+// Run it with go test -bench=StreamMemory -run=^$ ./crawler and compare the retained-B/page.
+func BenchmarkStreamMemory(b *testing.B) {
+	links := []link{}
+	for i := 0; i < 20; i++ {
+		links = append(links, link{url: fmt.Sprintf("https://example.com/page/%d", i), text: "a link to another page"})
+	}
+
+	for _, streamed := range []bool{false, true} {
+		name := "in-memory"
+		if streamed {
+			name = "stream-output"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			// with the reporters of the command line, which keep the pages for the text output unless they are streamed
+			reset()
+			if streamed {
+				stream = newStream(&countingFile{})
+			}
+			installReporters(io.Discard)
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			f := fetcher{}
+			for i := 0; i < b.N; i++ {
+				r := &result{title: "A page", status: 200, links: append([]link{}, links...)}
+				f.store(fmt.Sprintf("https://example.com/%d", i), r)
+			}
+
+			if streamed {
+				if err := stream.Close(); err != nil {
+					b.Fatal(err)
+				}
+				stream = nil
+			}
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(int64(after.HeapInuse)-int64(before.HeapInuse))/float64(b.N), "retained-B/page")
+			runtime.KeepAlive(f)
+		})
+	}
+}
+
+func TestBloomFalsePositives(t *testing.T) {
+	const n, p = 100000, 0.01
+	b := newBloomSet(n, p)
+
+	// while the filter fills up to n URLs, a new URL is taken for a seen one less often than p
+	skipped := 0
+	for i := 0; i < n; i++ {
+		if !b.Add(fmt.Sprintf("https://example.com/page/%d", i), 0) {
+			skipped++
+		}
+	}
+	if rate := float64(skipped) / n; rate > p {
+		t.Errorf("%.4f of the new URLs were taken for seen ones, want at most %.4f", rate, p)
+	}
+
+	// and once it is full, about p of the new URLs are
+	skipped = 0
+	for i := 0; i < n/10; i++ {
+		if !b.Add(fmt.Sprintf("https://example.com/other/%d", i), 0) {
+			skipped++
+		}
+	}
+	if rate := float64(skipped) / (n / 10); rate > 2*p {
+		t.Errorf("%.4f of the new URLs were taken for seen ones in a full filter, want about %.4f", rate, p)
+	}
+
+	// a URL that was added is always seen
+	if b.Add("https://example.com/page/42", 0) {
+		t.Errorf("a URL that was added is not seen")
+	}
+}
+
+func TestBloomCapacity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// the filter is sized for the URLs that are found, which are many more than the ones that are crawled
+	crawlWith(t, Config{MaxURLs: 500, Options: map[string]string{"respect_robots": "false", "approx-dedup": "true"}}, srv.URL+"/")
+	if n := bloomCapacity(); n != 10000 {
+		t.Errorf("the Bloom filter is sized for %d URLs, want 10000", n)
+	}
+	crawlWith(t, Config{MaxURLs: 500, Options: map[string]string{"respect_robots": "false", "approx-dedup": "true",
+		"approx-dedup-capacity": "123456"}}, srv.URL+"/")
+	if n := bloomCapacity(); n != 123456 {
+		t.Errorf("the Bloom filter is sized for %d URLs, want 123456", n)
+	}
+
+	// with m a power of two, the bit positions of a URL still spread over the filter
+	b := newBloomSet(5000, 0.01)
+	b.bits, b.m, b.k = make([]uint64, 1<<10), 1<<16, 7
+	skipped := 0
+	for i := 0; i < 5000; i++ {
+		if !b.Add(fmt.Sprintf("https://example.com/page/%d", i), 0) {
+			skipped++
+		}
+	}
+	if skipped > 10 {
+		t.Errorf("%d of 5000 new URLs were taken for seen ones", skipped)
+	}
+}
+
+func TestBloomMemory(t *testing.T) {
+	const n = 100000
+	urls := make([]string, n)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://example.com/section/%d/page.html", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	exact := exactSet{}
+	for _, u := range urls {
+		exact.Add(u, 1)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	exactBytes := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+	runtime.KeepAlive(exact)
+
+	// 1.44*log2(1000) bits is about 1.8 bytes per URL for p=0.001
+	bloom := newBloomSet(n, 0.001)
+	bloomBytes := int64(len(bloom.bits) * 8)
+	if perURL := float64(bloomBytes) / n; perURL > 2 {
+		t.Errorf("the Bloom filter takes %.2f bytes per URL, want about 1.8", perURL)
+	}
+	if exactBytes < 10*bloomBytes {
+		t.Errorf("the exact set takes %d bytes and the Bloom filter %d, want it at least 10 times smaller", exactBytes, bloomBytes)
+	}
+}
+
+func TestAdjacencyInScope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/a#top">a again</a><a href="https://other.example/">other</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{SameHost: true, Fetcher: f, Options: map[string]string{"respect_robots": "false"}}, srv.URL+"/")
+
+	path := filepath.Join(t.TempDir(), "crawl.json")
+	if err := reportAll(newAdjacencyReporter(path), f, nil); err != nil {
+		t.Fatal(err)
+	}
+	adj := map[string][]string{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &adj); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprint([]string{srv.URL + "/a"}); fmt.Sprint(adj[srv.URL+"/"]) != want {
+		t.Errorf("the start URL links to %v, want %s", adj[srv.URL+"/"], want)
+	}
+	if len(adj) != 2 {
+		t.Errorf("the adjacency list has %d pages, want 2: %v", len(adj), adj)
+	}
+}
+
+func TestStatsUniqueURLs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a><a href="/a">a again</a><a href="https://other.example/">other</a>`)
+		case "/a":
+			fmt.Fprint(w, `<a href="/">home</a><a href="/c">c</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	// the URLs in the scope are counted once, crawled or not (/c is at the maximal depth), and the other site by its rule
+	result := crawlWith(t, Config{Depth: 2, Options: map[string]string{"respect_robots": "false", "same_host": "true"}}, srv.URL+"/")
+	if result.Stats.URLs != 4 {
+		t.Errorf("found %d unique URLs, want 4", result.Stats.URLs)
+	}
+	if result.Stats.Skipped["--same_host"] != 1 {
+		t.Errorf("skipped %v, want 1 link by --same_host", result.Stats.Skipped)
+	}
+}
+
+func TestContentSelector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			// the <li> and <p> elements are closed implicitly, and do not close the <main> element
+			fmt.Fprint(w, `<a href=/nav>nav</a><main><ul><li><a href=/a>a</a><li><a href=/b>b</a></ul><p>text<main></main>`+
+				`<a href=/c>c</a></main><a href=/out>out</a>`)
+		case "/post":
+			fmt.Fprint(w, `<div class="post"><div><p>text<a href=/d>d</a></div><br><a href=/e>e</a></div><a href=/out>out</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	for selector, want := range map[string]string{"main": "[/a /b /c]", "div.post": "[/d /e]"} {
+		start := srv.URL + "/"
+		if selector == "div.post" {
+			start = srv.URL + "/post"
+		}
+		result := crawlWith(t, Config{Depth: 1, Options: map[string]string{"respect_robots": "false", "content-selector": selector}}, start)
+
+		links := []string{}
+		for _, l := range result.Pages[start].Links {
+			links = append(links, strings.TrimPrefix(l.URL, srv.URL))
+		}
+		if fmt.Sprint(links) != want {
+			t.Errorf("with --content-selector=%s the links are %v, want %s", selector, links, want)
+		}
+	}
+}
+
+func TestParseCSS(t *testing.T) {
+	fetched := map[string]int{}
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\n")
+		case "/", "/a", "/b":
+			fmt.Fprint(w, `<html><link rel="stylesheet" href="/site.css"><link rel="stylesheet" href="/private/hidden.css">`+
+				`<a href="/a">a</a><a href="/b">b</a>`)
+		case "/site.css":
+			fmt.Fprint(w, `@import "/more.css"; body { background: url(/bg.png) } .x { background: url("/from-css") }`)
+		case "/more.css":
+			fmt.Fprint(w, `@font-face { src: url(/font.woff2) } .y { background: url(/imported) }`)
+		case "/private/hidden.css":
+			fmt.Fprint(w, `.z { background: url(/hidden) }`)
+		}
+	}))
+	defer srv.Close()
+
+	result := crawlWith(t, Config{Depth: 2, Options: map[string]string{"parse-css": "true"}}, srv.URL+"/")
+
+	// the pages the stylesheets refer to are crawled, but not their images and fonts
+	for _, path := range []string{"/from-css", "/imported"} {
+		if _, ok := result.Pages[srv.URL+path]; !ok {
+			t.Errorf("%s was not crawled", path)
+		}
+	}
+	for _, path := range []string{"/bg.png", "/font.woff2", "/hidden"} {
+		if fetched[path] > 0 {
+			t.Errorf("%s was fetched", path)
+		}
+	}
+
+	// every stylesheet is fetched once, however many pages link to it, and not when robots.txt disallows it
+	for path, want := range map[string]int{"/site.css": 1, "/more.css": 1, "/private/hidden.css": 0} {
+		if fetched[path] != want {
+			t.Errorf("%s was fetched %d times, want %d", path, fetched[path], want)
+		}
+	}
+}
+
+func TestMainKeepsStdout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><title>Home</title><a href="/a">a</a>`)
+	}))
+	defer srv.Close()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	if os.Stderr, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0); err != nil {
+		t.Fatal(err)
+	}
+	printed := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		printed <- b
+	}()
+
+	// with --format=json only the document goes to stdout, and the progress to stderr, without swapping them
+	Main([]string{"--url=" + srv.URL + "/", "--depth=1", "--format=json", "--respect_robots=false"})
+	if os.Stdout != w {
+		t.Errorf("Main changed os.Stdout")
+	}
+	w.Close()
+
+	var doc jsonCrawl
+	if err := json.Unmarshal(<-printed, &doc); err != nil {
+		t.Fatalf("stdout is not only the JSON document: %v", err)
+	}
+	if doc.Pages != 1 {
+		t.Errorf("the document has %d pages, want 1", doc.Pages)
+	}
+}
+
+func TestOutputsWithStreamOutput(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><title>Home</title><a href="/a">a</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	// the other outputs get the pages as they are crawled, so they are written while the pages are streamed
+	dir := t.TempDir()
+	crawl := func(args ...string) {
+		Main(append([]string{"--url=" + srv.URL + "/", "--depth=2", "--respect_robots=false", "--quiet",
+			"--stream-output=" + filepath.Join(dir, "pages.jsonl")}, args...))
+	}
+
+	crawl("--format=json", "--output-file="+filepath.Join(dir, "crawl.json"))
+	var doc jsonCrawl
+	if b, err := os.ReadFile(filepath.Join(dir, "crawl.json")); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Results) != 2 || doc.Results[srv.URL+"/a"].Depth != 1 {
+		t.Errorf("the JSON document has the results %v, want / and /a at depth 1", doc.Results)
+	}
+
+	crawl("--format=sitemap", "--output-file="+filepath.Join(dir, "sitemap.xml"))
+	if b, err := os.ReadFile(filepath.Join(dir, "sitemap.xml")); err != nil || !bytes.Contains(b, []byte("<loc>"+srv.URL+"/a</loc>")) {
+		t.Errorf("the sitemap does not list /a: %s (%v)", b, err)
+	}
+
+	crawl("--output=sqlite", "--db="+filepath.Join(dir, "crawl.db"))
+	db, err := sql.Open("sqlite", filepath.Join(dir, "crawl.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pages WHERE depth = 1`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("the database has %d pages at depth 1 (%v), want 1", n, err)
+	}
+
+	crawl("--output=graphml", "--graphml="+filepath.Join(dir, "crawl.graphml"))
+	if b, err := os.ReadFile(filepath.Join(dir, "crawl.graphml")); err != nil || !bytes.Contains(b, []byte(`<data key="internal">true</data>`)) {
+		t.Errorf("the GraphML file does not have the internal link to /a: %s (%v)", b, err)
+	}
+
+	crawl("--output=adjacency", "--adjacency="+filepath.Join(dir, "adjacency.json"))
+	if b, err := os.ReadFile(filepath.Join(dir, "adjacency.json")); err != nil || !bytes.Contains(b, []byte(srv.URL+"/a")) {
+		t.Errorf("the adjacency list does not have /a: %s (%v)", b, err)
+	}
+}
+
+func TestRunChecksSeed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer srv.Close()
+
+	// the start URL is checked before the crawl, so nothing is reported
+	reported := 0
+	report := reporterFunc(func(url string, p Page) { reported++ })
+	c, err := New(Config{Reporters: []Reporter{report}, Options: map[string]string{"respect_robots": "false"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Run(context.Background(), srv.URL+"/"); err == nil || !strings.Contains(err.Error(), "410 Gone") {
+		t.Errorf("got the error %v, want the status of the start URL", err)
+	}
+	if reported != 0 {
+		t.Errorf("%d pages were reported", reported)
+	}
+
+	// unless the check is turned off
+	result := crawlWith(t, Config{Options: map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false"}}, srv.URL+"/")
+	if result.Pages[srv.URL+"/"].Status != http.StatusGone {
+		t.Errorf("the start URL was not crawled: %v", result.Pages)
+	}
+}
+
+func TestSitemapSeeds(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "Sitemap: %s/listed.xml\n", srv.URL)
+		case "/given.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/from-given</loc></url></urlset>`, srv.URL)
+		case "/listed.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/from-robots</loc></url></urlset>`, srv.URL)
+		default:
+			fmt.Fprint(w, `<html><title>A page</title>`)
+		}
+	}))
+	defer srv.Close()
+
+	// every sitemap option is read by Run as well, and their pages get depth 1
+	result := crawlWith(t, Config{Options: map[string]string{"sitemap": srv.URL + "/given.xml", "robots-sitemaps": "true"}},
+		srv.URL+"/")
+	for _, path := range []string{"/from-given", "/from-robots"} {
+		if d, ok := result.Depths[srv.URL+path]; !ok || d != 1 {
+			t.Errorf("%s has depth %d (found: %t), want 1", path, d, ok)
+		}
+		if _, ok := result.Pages[srv.URL+path]; !ok {
+			t.Errorf("%s was not crawled", path)
+		}
+	}
+}
+
+func TestRunWritesOptionFiles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><title>Home</title><a href="/a">a</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	// the options that write files work like on the command line
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+	result := crawlWith(t, Config{Options: map[string]string{"respect_robots": "false",
+		"stream-output": file("pages.jsonl"), "seen-db": file("seen.txt"), "output": "sqlite", "db": file("crawl.db"),
+		"graph": file("crawl.dot")}}, srv.URL+"/")
+	if len(result.Pages) != 0 || result.Stats.Pages != 2 {
+		t.Errorf("got %d pages of %d with stream-output, want 0 of 2", len(result.Pages), result.Stats.Pages)
+	}
+	for _, name := range []string{"pages.jsonl", "seen.txt", "crawl.db", "crawl.dot"} {
+		if info, err := os.Stat(file(name)); err != nil || info.Size() == 0 {
+			t.Errorf("%s was not written: %v", name, err)
+		}
+	}
+	// the crawl goes to the output-file in the format, also with stream-output
+	crawlWith(t, Config{Options: map[string]string{"respect_robots": "false", "stream-output": file("pages2.jsonl"),
+		"format": "csv", "output-file": file("crawl.csv")}}, srv.URL+"/")
+	if b, err := os.ReadFile(file("crawl.csv")); err != nil || !bytes.Contains(b, []byte(srv.URL+"/a")) {
+		t.Errorf("the CSV file does not have /a: %s (%v)", b, err)
+	}
+
+	// the options that only print a report, and the formats without a file to write them to, are rejected
+	for _, options := range []map[string]string{{"report-frontier": "true"}, {"verify-list": "urls.txt"}, {"format": "json"},
+		{"output": "urls"}} {
+		if _, err := New(Config{Options: options}); err == nil {
+			t.Errorf("New accepted the options %v", options)
+		}
+	}
+}
+
+func TestChunkedBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			return
+		}
+		// flushing before the end sends the page chunked, without a Content-Length
+		fmt.Fprint(w, `<html><title>Chunked</title><a href="/a">a</a>`)
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, strings.Repeat(" ", 200)+`<a href="/b">b</a>`)
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 1, Fetcher: f, Options: map[string]string{"respect_robots": "false", "max-body-size": "100"}},
+		srv.URL+"/")
+
+	r := f[srv.URL+"/"]
+	if r == nil || r.title != "Chunked" {
+		t.Fatalf("got the page %+v, want the title of the chunked page", r)
+	}
+	if len(r.links) != 1 || r.links[0].url != srv.URL+"/a" {
+		t.Errorf("got the links %v, want only /a before --max-body-size", r.links)
+	}
+	if r.size != 100 {
+		t.Errorf("read %d bytes, want the 100 of --max-body-size", r.size)
+	}
+}
+
+func TestNormalizeUnicode(t *testing.T) {
+	unicode, punycode := "http://café.com/menu", "http://xn--caf-dma.com/menu"
+	if normalizeURL(unicode) == normalizeURL(punycode) {
+		t.Errorf("the Unicode and punycode forms are the same page without --normalize-unicode")
+	}
+
+	*normalizeUnicode = true
+	defer func() { *normalizeUnicode = false }()
+	for _, u := range []string{unicode, punycode, "http://CAFÉ.com/menu"} {
+		if got := normalizeURL(u); got != punycode {
+			t.Errorf("normalizeURL(%s) = %s, want %s", u, got, punycode)
+		}
+	}
+}
+
+func TestSince(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><a href="/new">new</a><a href="/old">old</a><a href="/unchanged">unchanged</a>`)
+		case "/new":
+			w.Header().Set("Last-Modified", "Sat, 01 Jun 2024 12:00:00 GMT")
+			fmt.Fprint(w, `<html><a href="/new/child">child</a>`)
+		case "/old":
+			w.Header().Set("Last-Modified", "Wed, 01 Jan 2020 12:00:00 GMT")
+			fmt.Fprint(w, `<html><a href="/old/child">child</a>`)
+		case "/unchanged":
+			if r.Header.Get("If-Modified-Since") != "" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			fmt.Fprint(w, `<html><a href="/unchanged/child">child</a>`)
+		default:
+			fmt.Fprint(w, `<html><title>Child</title>`)
+		}
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 3, Fetcher: f, Options: map[string]string{"respect_robots": "false", "since": "2023-01-01"}},
+		srv.URL+"/")
+
+	for path, old := range map[string]bool{"/": false, "/new": false, "/old": true, "/unchanged": true} {
+		if r := f[srv.URL+path]; r == nil || r.old != old {
+			t.Errorf("got the page %s %+v, want it recorded with old=%v", path, r, old)
+		}
+	}
+	for path, crawled := range map[string]bool{"/new/child": true, "/old/child": false, "/unchanged/child": false} {
+		if _, ok := f[srv.URL+path]; ok != crawled {
+			t.Errorf("%s crawled: %v, want %v", path, ok, crawled)
+		}
+	}
+}
+
+func TestNeverEndingBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><a href="/hang">hang</a>`)
+			return
+		}
+		// the terminating chunk never comes
+		fmt.Fprint(w, `<html><title>Hanging</title><a href="/a">a</a>`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	start := time.Now()
+	crawlWith(t, Config{Depth: 2, Fetcher: f, Options: map[string]string{"respect_robots": "false", "timeout": "200ms",
+		"retries": "0"}}, srv.URL+"/")
+
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("the crawl took %v, want it to stop reading at the --timeout of 200ms", d)
+	}
+	r := f[srv.URL+"/hang"]
+	if r == nil || r.err == nil || !r.truncated {
+		t.Errorf("got the page %+v, want it recorded as broken off by the timeout", r)
+	}
+}
+
+func TestGroupByStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><a href="/choices">a</a><a href="/missing">b</a><a href="/broken">c</a><a href="/reset">d</a>`)
+		case "/choices":
+			w.WriteHeader(http.StatusMultipleChoices)
+		case "/missing":
+			http.NotFound(w, r)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/reset":
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "crawl.txt")
+	crawlWith(t, Config{Depth: 2, Options: map[string]string{"respect_robots": "false", "retries": "0",
+		"group-by-status": "true", "output-file": path}}, srv.URL+"/")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every bucket has its header with the count, followed by its URLs
+	got := string(b)
+	for bucket, page := range map[string]string{"2xx": "/ (200)", "3xx": "/choices (300)", "4xx": "/missing (404)",
+		"5xx": "/broken (500)", "errors": "/reset ("} {
+		if !strings.Contains(got, fmt.Sprintf("=== %s (1)\n%s%s", bucket, srv.URL, page)) {
+			t.Errorf("the output does not have %s in the bucket %s:\n%s", page, bucket, got)
+		}
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><title>\n\t  Crème brûlée\n\t  recipes  \r\n</title>")
+	}))
+	defer srv.Close()
+
+	for maxLen, want := range map[string]string{"0": "Crème brûlée recipes", "12": "Crème brûlée…"} {
+		result := crawlWith(t, Config{Depth: 1, Options: map[string]string{"respect_robots": "false", "title-max-len": maxLen}},
+			srv.URL+"/")
+		if got := result.Pages[srv.URL+"/"].Title; got != want {
+			t.Errorf("got the title %q with --title-max-len=%s, want %q", got, maxLen, want)
+		}
+	}
+}
+
+func TestMaxPagination(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscanf(r.URL.Path, "/page/%d", &n)
+		fmt.Fprintf(w, `<html><title>Page %d</title><a rel="next" href="/page/%d">Next</a>`, n, n+1)
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 30, Fetcher: f, Options: map[string]string{"respect_robots": "false", "max-pagination": "3"}},
+		srv.URL+"/page/1")
+
+	// the start page and the 3 pages after it are crawled, and the last one is marked as capped
+	if len(f) != 4 {
+		t.Errorf("crawled %v, want /page/1 to /page/4", f.sortedURLs())
+	}
+	for n := 1; n <= 4; n++ {
+		if r := f[fmt.Sprintf("%s/page/%d", srv.URL, n)]; r == nil || r.capped != (n == 4) {
+			t.Errorf("got the page %d %+v, want it crawled with capped=%v", n, r, n == 4)
+		}
+	}
+}
+
+func TestVerifyList(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok", "/also-ok":
+			fmt.Fprint(w, `<html><a href="/linked">not verified</a>`)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/linked":
+			t.Error("a link of a listed URL was followed")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	list := filepath.Join(t.TempDir(), "urls.txt")
+	urls := fmt.Sprintf("# the pages that must exist\n%[1]s/ok\n\n%[1]s/moved\n%[1]s/missing\n  %[1]s/also-ok  \n", srv.URL)
+	if err := os.WriteFile(list, []byte(urls), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	failed, err := verifyList(&out, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Main exits with status 1 when any failed
+	if failed != 1 {
+		t.Errorf("%d URLs failed, want only /missing", failed)
+	}
+	for _, line := range []string{"OK   " + srv.URL + "/ok (200)", "OK   " + srv.URL + "/moved (200)",
+		"FAIL " + srv.URL + "/missing (404)", "OK   " + srv.URL + "/also-ok (200)", "Verified 4 URLs, 1 failed"} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("the report does not have %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestHTTP1AndForceClose(t *testing.T) {
+	var mu sync.Mutex
+	protos := map[string]bool{}
+	requests, conns := 0, 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		protos[r.Proto] = true
+		requests++
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><a href="/a">a</a><a href="/b">b</a>`)
+		}
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	// without the options the pages are fetched over one HTTP/2 connection, and with them every request has its own
+	for _, test := range []struct {
+		options map[string]string
+		proto   string
+		closed  bool
+	}{
+		{map[string]string{}, "HTTP/2.0", false},
+		{map[string]string{"http1": "true"}, "HTTP/1.1", true},
+		{map[string]string{"force-close": "true"}, "HTTP/2.0", true},
+	} {
+		mu.Lock()
+		protos, requests, conns = map[string]bool{}, 0, 0
+		mu.Unlock()
+		test.options["respect_robots"], test.options["insecure"] = "false", "true"
+		crawlWith(t, Config{Depth: 2, Options: test.options}, srv.URL+"/")
+
+		mu.Lock()
+		if len(protos) != 1 || !protos[test.proto] {
+			t.Errorf("got the protocols %v with %v, want only %s", protos, test.options, test.proto)
+		}
+		if (test.closed && conns < requests) || (!test.closed && conns != 1) {
+			t.Errorf("made %d requests over %d connections with %v", requests, conns, test.options)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestHostHeaders(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string][]string{}
+	record := func(host string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			got[host] = append(got[host], r.URL.Path+" "+r.Header.Get("X-Token")+" "+r.Header.Get("X-Team"))
+			mu.Unlock()
+		}
+	}
+
+	// the other host is on localhost, and the start URL on 127.0.0.1
+	other := httptest.NewServer(record("localhost"))
+	defer other.Close()
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("127.0.0.1")(w, r)
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<html><a href="%[1]s/page">page</a><a href="/redirect">redirect</a>`, otherURL)
+		case "/redirect":
+			http.Redirect(w, r, otherURL+"/moved", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{"headers": {"127.0.0.1": {"X-Token": "first"},
+		"LocalHost": {"X-Token": "second", "X-Team": "crawlers"}}}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	crawlWith(t, Config{Depth: 2, Options: map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false",
+		"config": config}}, srv.URL+"/")
+
+	// the redirect to the other host gets its headers instead of those of the first host
+	for host, want := range map[string][]string{"127.0.0.1": {"/ first ", "/redirect first "},
+		"localhost": {"/moved second crawlers", "/page second crawlers"}} {
+		sort.Strings(got[host])
+		if !slices.Equal(got[host], want) {
+			t.Errorf("%s got the requests %q, want %q", host, got[host], want)
+		}
+	}
+}
+
+func TestExtractMedia(t *testing.T) {
+	var mu sync.Mutex
+	requested := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, `<html><body>
+			<video src="intro.mp4"></video>
+			<video controls><source src="/clips/talk.webm" type="video/webm"><source src="clips/talk.mp4"></video>
+			<audio><source src="https://cdn.example.com/podcast.mp3"></audio>
+			<picture><source srcset="photo.webp"><img src="photo.jpg"></picture>`)
+	}))
+	defer srv.Close()
+
+	for _, extract := range []bool{false, true} {
+		f := fetcher{}
+		requested = nil
+		crawlWith(t, Config{Depth: 3, Fetcher: f, Options: map[string]string{"respect_robots": "false",
+			"fail-fast-on-seed": "false", "extract-media": fmt.Sprint(extract)}}, srv.URL+"/docs/talks.html")
+
+		// the media are resolved against the page, and recorded without crawling them
+		var want []string
+		if extract {
+			want = []string{srv.URL + "/docs/intro.mp4", srv.URL + "/clips/talk.webm", srv.URL + "/docs/clips/talk.mp4",
+				"https://cdn.example.com/podcast.mp3"}
+		}
+		if got := f[srv.URL+"/docs/talks.html"].media; !slices.Equal(got, want) {
+			t.Errorf("got the media %v with --extract-media=%v, want %v", got, extract, want)
+		}
+		if len(requested) != 1 {
+			t.Errorf("requested %v, want only the page", requested)
+		}
+	}
+}
+
+func TestTrailingDotHost(t *testing.T) {
+	s := &stubFetcher{links: map[string][]string{
+		"https://example.com/": {"https://example.com./a", "https://example.com/a", "https://Example.COM./",
+			"https://blog.example.com./b", "https://example.org./c"},
+	}}
+	result := crawlWith(t, Config{Depth: 3, Fetcher: s, Options: map[string]string{"respect_robots": "false",
+		"same-domain": "true"}}, "https://example.com./")
+
+	// both forms of a host are the same page, and the same domain
+	want := []string{"https://blog.example.com/b", "https://example.com/", "https://example.com/a"}
+	got := []string{}
+	for u := range result.Depths {
+		got = append(got, u)
+	}
+	sort.Strings(got)
+	if !slices.Equal(got, want) || s.fetched != 3 {
+		t.Errorf("fetched %d pages %v, want %v", s.fetched, got, want)
+	}
+}
+
+func TestAnchorTextMatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><a href="/next">Next <b>page</b></a><a href="/more">
+				Read   more</a><a href="/about">About us</a><a href="/icon"><img src="x.png"></a>`)
+			return
+		}
+		fmt.Fprint(w, `<html><title>Page</title>`)
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 2, Fetcher: f, Options: map[string]string{"respect_robots": "false",
+		"anchor-text-match": "(?i)^(next page|read more)$"}}, srv.URL+"/")
+
+	// every link is recorded, but only the ones with matching text are followed
+	if got := len(f[srv.URL+"/"].links); got != 4 {
+		t.Errorf("recorded %d links, want 4", got)
+	}
+	want := []string{srv.URL + "/", srv.URL + "/more", srv.URL + "/next"}
+	if got := f.sortedURLs(); !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+}
+
+func TestExtractHeadings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><h1>Guide</h1><p>Intro</p>
+			<h2>Install <code>gocrawler</code></h2><h3>From
+			source</h3><h2>Usage</h2><h4>Skipped a level</h4><h1>Appendix</h1>`)
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 1, Fetcher: f, Options: map[string]string{"respect_robots": "false", "extract-headings": "true"}},
+		srv.URL+"/")
+
+	want := []heading{{1, "Guide"}, {2, "Install gocrawler"}, {3, "From source"}, {2, "Usage"}, {4, "Skipped a level"},
+		{1, "Appendix"}}
+	if got := f[srv.URL+"/"].headings; !slices.Equal(got, want) {
+		t.Errorf("got the outline %v, want %v", got, want)
+	}
+}
+
+func TestShortestPathDepth(t *testing.T) {
+	// /x is 3 links away along the long path, but 2 along the short one
+	s := &stubFetcher{links: map[string][]string{
+		"https://example.com/":      {"https://example.com/long1", "https://example.com/short"},
+		"https://example.com/long1": {"https://example.com/long2"},
+		"https://example.com/long2": {"https://example.com/x"},
+		"https://example.com/short": {"https://example.com/x"},
+		"https://example.com/x":     {"https://example.com/y"},
+	}}
+	result := crawlWith(t, Config{Depth: 3, Fetcher: s, Options: map[string]string{"respect_robots": "false"}},
+		"https://example.com/")
+
+	for path, want := range map[string]int{"/": 0, "/long1": 1, "/short": 1, "/long2": 2, "/x": 2, "/y": 3} {
+		if got, ok := result.Depths["https://example.com"+path]; !ok || got != want {
+			t.Errorf("%s is at depth %d (found: %v), want %d", path, got, ok, want)
+		}
+	}
+
+	// with a depth of 3 the pages at depth 2 are crawled, so /x is, and /y is only found
+	sort.Strings(s.urls)
+	want := []string{"https://example.com/", "https://example.com/long1", "https://example.com/long2",
+		"https://example.com/short", "https://example.com/x"}
+	if !slices.Equal(s.urls, want) {
+		t.Errorf("fetched %v, want %v", s.urls, want)
+	}
+}
+
+func TestTLSProblems(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><title>Secure</title>`)
+	}))
+	defer srv.Close()
+
+	// the certificate of the test server is for 127.0.0.1 and example.com, and signed by its own authority
+	localhost := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	for _, test := range []struct {
+		start, problem string
+		client         *http.Client
+	}{
+		{srv.URL + "/", "certificate signed by unknown authority", nil},
+		{localhost + "/", "x509: certificate is valid for example.com", srv.Client()},
+	} {
+		f := fetcher{}
+		crawlWith(t, Config{Depth: 1, Fetcher: f, Client: test.client, Options: map[string]string{"respect_robots": "false",
+			"fail-fast-on-seed": "false"}}, test.start)
+
+		var out bytes.Buffer
+		saved := console
+		console = &out
+		printTLSReport(f)
+		console = saved
+
+		host := strings.TrimPrefix(strings.TrimSuffix(test.start, "/"), "https://")
+		want := fmt.Sprintf("=== TLS problems (1 hosts)\n%s: %s", host, test.problem)
+		if !strings.Contains(out.String(), want) || !strings.HasSuffix(out.String(), " (1 URLs)\n") {
+			t.Errorf("got the report %q, want %q", out.String(), want)
+		}
+	}
+}
+
+func TestSameDirectory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/docs/guide/intro.html" {
+			fmt.Fprint(w, `<html><a href="setup.html">sibling</a><a href="api/reference.html">below</a>
+				<a href="../index.html">parent</a><a href="/blog/post.html">unrelated</a><a href="/docs/guide-old/x.html">prefix</a>`)
+			return
+		}
+		fmt.Fprint(w, `<html><title>Page</title>`)
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 2, Fetcher: f, Options: map[string]string{"respect_robots": "false", "same-directory": "true"}},
+		srv.URL+"/docs/guide/intro.html")
+
+	want := []string{srv.URL + "/docs/guide/api/reference.html", srv.URL + "/docs/guide/intro.html",
+		srv.URL + "/docs/guide/setup.html"}
+	if got := f.sortedURLs(); !slices.Equal(got, want) {
+		t.Errorf("crawled %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeDefaultDocuments(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		fmt.Fprint(w, `<html><a href="/docs/">a</a><a href="/docs">b</a><a href="/docs/default.aspx">c</a>
+			<a href="/docs/Default.ASPX">d</a><a href="/docs/home.php">e</a>`)
+	}))
+	defer srv.Close()
+
+	// the default documents, the directory and the directory without its slash are all the same page, unless
+	// the normalizations are turned off
+	for _, test := range []struct {
+		options  map[string]string
+		requests int
+	}{
+		{map[string]string{"normalize-default-documents": "true", "default-documents": "index.html,default.aspx"}, 3},
+		{map[string]string{"normalize-default-documents": "true", "default-documents": "index.html,default.aspx",
+			"normalize-trailing-slash": "false"}, 4},
+		{map[string]string{}, 5},
+	} {
+		requests = map[string]int{}
+		test.options["respect_robots"], test.options["fail-fast-on-seed"] = "false", "false"
+		crawlWith(t, Config{Depth: 2, Options: test.options}, srv.URL+"/")
+
+		n := 0
+		for _, count := range requests {
+			n += count
+		}
+		if n != test.requests {
+			t.Errorf("got the requests %v with %v, want %d", requests, test.options, test.requests)
+		}
+	}
+}
+
+func TestGraphMLDocument(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><title>Tom &amp; Jerry's "<cartoons>"</title><a href="/a?x=1&amp;y=2">a</a>`)
+		case "/a":
+			fmt.Fprint(w, `<html><title>A</title><a href="/">home</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "crawl.graphml")
+	crawlWith(t, Config{Depth: 3, Options: map[string]string{"respect_robots": "false", "output": "graphml",
+		"graphml": path}}, srv.URL+"/")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		XMLName xml.Name
+		Keys    []graphMLKey `xml:"key"`
+		Graph   struct {
+			EdgeDefault string        `xml:"edgedefault,attr"`
+			Nodes       []graphMLNode `xml:"node"`
+			Edges       []graphMLEdge `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("the GraphML file is not valid XML: %v\n%s", err, b)
+	}
+	if doc.XMLName.Space != "http://graphml.graphdrawing.org/xmlns" || doc.XMLName.Local != "graphml" ||
+		doc.Graph.EdgeDefault != "directed" {
+		t.Errorf("got the root %v with edgedefault %q, want a directed graphml graph", doc.XMLName, doc.Graph.EdgeDefault)
+	}
+
+	// like the schema asks, every data refers to a key for its kind of element, and every edge to two nodes
+	keys := map[string]string{}
+	for _, k := range doc.Keys {
+		keys[k.ID] = k.For
+	}
+	nodes := map[string]map[string]string{}
+	for _, n := range doc.Graph.Nodes {
+		nodes[n.ID] = map[string]string{}
+		for _, d := range n.Data {
+			if keys[d.Key] != "node" {
+				t.Errorf("the node %s has data for the undeclared key %q", n.ID, d.Key)
+			}
+			nodes[n.ID][d.Key] = d.Value
+		}
+	}
+	for _, e := range doc.Graph.Edges {
+		if nodes[e.Source] == nil || nodes[e.Target] == nil {
+			t.Errorf("the edge %s -> %s is not between two nodes", e.Source, e.Target)
+		}
+	}
+
+	found := map[string]map[string]string{}
+	for _, data := range nodes {
+		found[data["url"]] = data
+	}
+	home, a := found[srv.URL+"/"], found[srv.URL+"/a?x=1&y=2"]
+	if home["title"] != `Tom & Jerry's "<cartoons>"` || home["depth"] != "0" || home["status"] != "200" {
+		t.Errorf("got the start page %v, want its escaped title, depth 0 and status 200", home)
+	}
+	if a["depth"] != "1" || len(doc.Graph.Edges) != 2 {
+		t.Errorf("got the page %v and %d edges, want /a at depth 1 and an edge in both directions", a, len(doc.Graph.Edges))
+	}
+}
+
+func TestProxyRules(t *testing.T) {
+	var mu sync.Mutex
+	var proxied, direct []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		fmt.Fprint(w, `<html><title>Through the proxy</title>`)
+	}))
+	defer proxy.Close()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		direct = append(direct, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+			fmt.Fprintf(w, `<html><a href="%s/page">proxied</a><a href="/direct">direct</a>`, other)
+		}
+	}))
+	defer srv.Close()
+
+	// the requests to localhost go through the proxy, and the ones to 127.0.0.1 do not, even with --proxy
+	config := filepath.Join(t.TempDir(), "config.json")
+	rules := fmt.Sprintf(`{"proxies": {"localhost": %q, "*": "DIRECT"}}`, proxy.URL)
+	if err := os.WriteFile(config, []byte(rules), 0666); err != nil {
+		t.Fatal(err)
+	}
+	crawlWith(t, Config{Depth: 2, Options: map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false",
+		"config": config, "proxy": proxy.URL}}, srv.URL+"/")
+
+	sort.Strings(direct)
+	wantProxied := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1) + "/page"
+	if !slices.Equal(proxied, []string{wantProxied}) || !slices.Equal(direct, []string{"/", "/direct"}) {
+		t.Errorf("got the proxied requests %v and the direct ones %v, want %s through the proxy", proxied, direct,
+			wantProxied)
+	}
+}
+
+func TestRedirectChains(t *testing.T) {
+	hops := map[string]string{"/start": "/hop1", "/hop1": "/hop2", "/hop2": "/end", "/once": "/end"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if next, ok := hops[r.URL.Path]; ok {
+			http.Redirect(w, r, next, http.StatusMovedPermanently)
+			return
+		}
+		fmt.Fprint(w, `<html><a href="/start">3 hops</a><a href="/once">1 hop</a>`)
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 2, Fetcher: f, Options: map[string]string{"respect_robots": "false"}}, srv.URL+"/")
+
+	var out bytes.Buffer
+	saved := console
+	console = &out
+	printRedirectChains(f, 2)
+	console = saved
+
+	want := fmt.Sprintf("\n=== Redirect chains longer than 2 (1)\n%[1]s/start (3 redirects)\n|-> %[1]s/hop1\n"+
+		"|-> %[1]s/hop2\n|-> %[1]s/end\n", srv.URL)
+	if out.String() != want {
+		t.Errorf("got the report %q, want %q", out.String(), want)
+	}
+}
+
+func TestCrawlFiles(t *testing.T) {
+	dir := t.TempDir()
+	pages := map[string]string{
+		"index.html":      `<title>Home</title><a href="page2.html">2</a><a href="docs/page3.html">3</a>`,
+		"page2.html":      `<title>Two</title><a href="./index.html">home</a>`,
+		"docs/page3.html": `<title>Three</title><a href="../page4.html">4</a>`,
+		"page4.html":      `<title>Four</title><a href="report.pdf">a file</a>`,
+	}
+	for name, body := range pages {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the relative links resolve against the path of the file they are in
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 5, Fetcher: f, Options: map[string]string{"respect_robots": "false"}},
+		"file://"+filepath.ToSlash(dir)+"/index.html")
+
+	for name, title := range map[string]string{"index.html": "Home", "page2.html": "Two", "docs/page3.html": "Three",
+		"page4.html": "Four"} {
+		if r := f["file://"+filepath.ToSlash(dir)+"/"+name]; r == nil || r.title != title {
+			t.Errorf("got the file %s %+v, want it crawled with the title %q", name, r, title)
+		}
+	}
+	if len(f) != 4 {
+		t.Errorf("crawled %v, want only the 4 HTML files", f.sortedURLs())
+	}
+}
+
+func TestSummaryOnly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><title>Page</title><a href="/a">a</a><a href="/missing">missing</a>`)
+	}))
+	defer srv.Close()
+
+	for _, summaryOnly := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "crawl.txt")
+		crawlWith(t, Config{Depth: 2, Options: map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false",
+			"summary-only": fmt.Sprint(summaryOnly), "output-file": path}}, srv.URL+"/")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only the statistics are printed, without a line for any of the URLs
+		got := string(b)
+		if !strings.Contains(got, "=== Summary\nPages crawled: 3\nUnique URLs:   3\n") || !strings.Contains(got, "Bytes read:") {
+			t.Errorf("the output with --summary-only=%v does not have the statistics:\n%s", summaryOnly, got)
+		}
+		if listed := strings.Contains(got, srv.URL); listed == summaryOnly {
+			t.Errorf("the output with --summary-only=%v lists the URLs: %v, want %v\n%s", summaryOnly, listed, !listed, got)
+		}
+	}
+}
+
+func TestCompressionRatio(t *testing.T) {
+	page := `<html><title>Compressed</title><a href="/plain">plain</a>` + strings.Repeat("<p>The same paragraph.</p>", 200)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plain" || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			fmt.Fprint(w, page)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, page)
+		gz.Close()
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 2, Fetcher: f, Options: map[string]string{"respect_robots": "false"}}, srv.URL+"/")
+
+	// the gzipped page is read in full, and its ratio is the size of the page over the bytes transferred
+	gzipped, plain := f[srv.URL+"/"], f[srv.URL+"/plain"]
+	if gzipped == nil || gzipped.title != "Compressed" || gzipped.size != int64(len(page)) || compressionRatio(gzipped) <= 10 {
+		t.Errorf("got the gzipped page %+v, want all %d bytes of it read with a ratio above 10", gzipped, len(page))
+	}
+	if plain == nil || compressionRatio(plain) != 1 {
+		t.Errorf("got the uncompressed page %+v, want ratio 1", plain)
+	}
+	if got := poorlyCompressed(f, 2); !slices.Equal(got, []string{srv.URL + "/plain"}) {
+		t.Errorf("got the poorly compressed pages %v, want only /plain", got)
+	}
+}
+
+func TestOnPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><a href="/a">a</a><a href="/b">b</a>`)
+			return
+		}
+		fmt.Fprint(w, `<html><title>Leaf</title>`)
+	}))
+	defer srv.Close()
+
+	// the command counts the bytes of every page it gets on stdin
+	out := filepath.Join(t.TempDir(), "sizes.txt")
+	command := fmt.Sprintf(`echo "$1 $GOCRAWLER_URL $(wc -c)" >> %s`, out)
+	crawlWith(t, Config{Depth: 2, Options: map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false",
+		"on-page": command, "on-page-concurrency": "1"}}, srv.URL+"/")
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	sort.Strings(lines)
+	want := []string{srv.URL + "/ " + srv.URL + "/ 42", srv.URL + "/a " + srv.URL + "/a 25", srv.URL + "/b " + srv.URL + "/b 25"}
+	if !slices.Equal(lines, want) {
+		t.Errorf("the command wrote %q, want one line for every page: %q", lines, want)
+	}
+
+	// with on-page-abort, a failing command stops the crawl
+	c, err := New(Config{Depth: 2, Options: map[string]string{"respect_robots": "false", "on-page": "exit 3",
+		"on-page-abort": "true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Run(context.Background(), srv.URL+"/"); err == nil || !strings.Contains(err.Error(), "--on-page command failed") {
+		t.Errorf("got the error %v, want the failed command", err)
+	}
+}
+
+func TestSelfLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><a href="/docs">docs</a><a href="/about">about</a><a href="/other">other</a>`)
+		case "/docs":
+			fmt.Fprint(w, `<html><a href="/docs/">docs</a><a href="/docs#intro">intro</a><a href="/">home</a>`)
+		case "/about":
+			fmt.Fprint(w, `<html><a href="/about">about</a>`)
+		default:
+			fmt.Fprint(w, `<html><a href="/docs">docs</a>`)
+		}
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 2, Fetcher: f, Options: map[string]string{"respect_robots": "false"}}, srv.URL+"/")
+
+	// the trailing slash variant and the fragment are links to the page itself as well
+	got := selfLinks(f)
+	want := map[string][]string{srv.URL + "/docs": {srv.URL + "/docs/", srv.URL + "/docs"},
+		srv.URL + "/about": {srv.URL + "/about"}}
+	if len(got) != len(want) {
+		t.Errorf("got the self links %v, want %v", got, want)
+	}
+	for page, links := range want {
+		if !slices.Equal(got[page], links) {
+			t.Errorf("got the self links %v on %s, want %v", got[page], page, links)
+		}
+	}
+}
+
+func TestCompareTitles(t *testing.T) {
+	var mu sync.Mutex
+	title := "Spring sale"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><title>Shop</title><a href="/offers">offers</a>`)
+			return
+		}
+		fmt.Fprintf(w, `<html><title>%s</title>`, title)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "crawl.jsonl")
+	crawlWith(t, Config{Depth: 2, Options: map[string]string{"respect_robots": "false", "stream-output": path}}, srv.URL+"/")
+
+	// the offers page has another title in the next crawl, and the start page only changed its case
+	mu.Lock()
+	title = "Summer  sale"
+	mu.Unlock()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	if os.Stderr, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0); err != nil {
+		t.Fatal(err)
+	}
+	printed := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		printed <- b
+	}()
+
+	Main([]string{"--url=" + srv.URL + "/", "--depth=2", "--respect_robots=false", "--summary-only", "--stream-output=",
+		"--compare-titles=" + path})
+	w.Close()
+
+	want := fmt.Sprintf("\n=== Changed titles (1)\n%s/offers\n|-- was: Spring sale\n|-- now: Summer sale\n", srv.URL)
+	if got := string(<-printed); !strings.Contains(got, want) {
+		t.Errorf("the report does not have the changed title %q:\n%s", want, got)
+	}
+}
+
+func TestMaxPerLevel(t *testing.T) {
+	s := &stubFetcher{links: map[string][]string{}}
+	for i := 0; i < 10; i++ {
+		page := fmt.Sprintf("https://example.com/%d", i)
+		s.links["https://example.com/"] = append(s.links["https://example.com/"], page)
+		for j := 0; j < 10; j++ {
+			s.links[page] = append(s.links[page], fmt.Sprintf("%s/%d", page, j))
+		}
+	}
+	result := crawlWith(t, Config{Depth: 4, Fetcher: s, Options: map[string]string{"respect_robots": "false",
+		"max-per-level": "3"}}, "https://example.com/")
+
+	// every level below the start URL has 3 of its pages crawled, and the links of those are still found
+	perLevel := map[int]int{}
+	for _, u := range s.urls {
+		perLevel[result.Depths[u]]++
+	}
+	if want := map[int]int{0: 1, 1: 3, 2: 3}; fmt.Sprint(perLevel) != fmt.Sprint(want) {
+		t.Errorf("crawled %v pages per level, want %v", perLevel, want)
+	}
+	if found := len(result.Depths); found != 1+10+3*10 {
+		t.Errorf("found %d URLs, want the %d on the crawled pages", found, 1+10+3*10)
+	}
+}
+
+func TestMaxPathDepth(t *testing.T) {
+	s := &stubFetcher{links: map[string][]string{
+		"https://example.com/": {"https://example.com/a", "https://example.com/a/b/", "https://example.com/a/b/c",
+			"https://example.com/a/b/c/d?page=1"},
+		"https://example.com/a": {"https://example.com/x/y/z/w", "https://example.com/x/y"},
+	}}
+	result := crawlWith(t, Config{Depth: 3, Fetcher: s, Options: map[string]string{"respect_robots": "false",
+		"max-path-depth": "2"}}, "https://example.com/")
+
+	// however they were found, only the URLs with at most 2 path segments are crawled
+	sort.Strings(s.urls)
+	want := []string{"https://example.com/", "https://example.com/a", "https://example.com/a/b", "https://example.com/x/y"}
+	if !slices.Equal(s.urls, want) {
+		t.Errorf("crawled %v, want %v", s.urls, want)
+	}
+	if skipped := result.Stats.Skipped["--max-path-depth"]; skipped != 3 {
+		t.Errorf("%d URLs were skipped for their path depth, want 3", skipped)
+	}
+}
+
+func TestOpenGraphTitle(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><meta property="og:title" content="  Only   Open Graph ">
+				<meta property="og:description" content="A page without a title"><meta property="og:image" content="/card.png">
+				</head><a href="/both">both</a>`)
+		case "/both":
+			fmt.Fprint(w, `<html><title>The title</title><meta property="og:title" content="The Open Graph title">`)
+		}
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 2, Fetcher: f, Options: map[string]string{"respect_robots": "false"}}, srv.URL+"/")
+
+	// the og:title is only used when there is no <title>
+	home := f[srv.URL+"/"]
+	if home == nil || home.title != "Only Open Graph" || home.openGraph["og:description"] != "A page without a title" ||
+		home.openGraph["og:image"] != "/card.png" {
+		t.Errorf("got the page %+v, want the og:title as its title and the Open Graph meta", home)
+	}
+	if both := f[srv.URL+"/both"]; both == nil || both.title != "The title" {
+		t.Errorf("got the page %+v, want its <title>", both)
+	}
+}
+
+func TestResumeWithNarrowerScope(t *testing.T) {
+	var mu sync.Mutex
+	fetched := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, `<html><title>Page</title>`)
+	}))
+	defer srv.Close()
+
+	// the state of an interrupted crawl that crawled the start URL, and found three pages on it
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"visited.json":  `{"%[1]s/": 0, "%[1]s/docs/a": 1, "%[1]s/blog/b": 1, "%[1]s/docs/c": 1}`,
+		"frontier.json": `{"%[1]s/docs/a": 1, "%[1]s/blog/b": 1, "%[1]s/docs/c": 1}`,
+		"results.json":  `[{"url": "%[1]s/", "title": "Home", "status": 200, "links": []}]`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(fmt.Sprintf(content, srv.URL)), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the crawl is resumed without the blog, which is dropped from the frontier but kept in the saved state
+	crawlWith(t, Config{Depth: 3, Options: map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false",
+		"state": dir, "resume": "true", "deny": "/blog/"}}, srv.URL+"/")
+
+	sort.Strings(fetched)
+	if want := []string{"/docs/a", "/docs/c"}; !slices.Equal(fetched, want) {
+		t.Errorf("fetched %v, want %v", fetched, want)
+	}
+	frontier := map[string]int{}
+	if err := readJSON(filepath.Join(dir, "frontier.json"), &frontier); err != nil {
+		t.Fatal(err)
+	}
+	if len(frontier) != 1 || frontier[srv.URL+"/blog/b"] != 1 {
+		t.Errorf("saved the frontier %v, want only the blog for a wider crawl later", frontier)
+	}
+}
+
+func TestDuplicateTitleThreshold(t *testing.T) {
+	var mu sync.Mutex
+	fetched := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched++
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<html><title>Home</title>`)
+			for i := 0; i < 10; i++ {
+				fmt.Fprintf(w, `<a href="/account/%d">%d</a>`, i, i)
+			}
+			return
+		}
+		fmt.Fprint(w, `<html><title>Please log in</title>`)
+	}))
+	defer srv.Close()
+
+	stderr := os.Stderr
+	defer func() { os.Stderr = stderr }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stderr = w
+	printed := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		printed <- b
+	}()
+
+	// the host is stopped when the fourth page has the same title
+	crawlWith(t, Config{Depth: 2, Concurrency: 1, Options: map[string]string{"respect_robots": "false",
+		"fail-fast-on-seed": "false", "duplicate-title-threshold": "3", "duplicate-title-stop": "true"}}, srv.URL+"/")
+	w.Close()
+	os.Stderr = stderr
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	want := fmt.Sprintf("More than 3 pages on %s have the title \"Please log in\", the crawl may be stuck in a trap\n"+
+		"Stopped crawling %s\n", host, host)
+	if got := string(<-printed); strings.Count(got, want) != 1 {
+		t.Errorf("got the warnings %q, want %q once", got, want)
+	}
+	if fetched != 5 {
+		t.Errorf("fetched %d pages, want the start URL and the 4 pages with the same title", fetched)
+	}
+}
+
+func TestSeenDB(t *testing.T) {
+	var mu sync.Mutex
+	fetched := []string{}
+	links := `<a href="/a">a</a>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetched = append(fetched, r.URL.Path)
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, "<html>"+links)
+		}
+	}))
+	defer srv.Close()
+
+	db := filepath.Join(t.TempDir(), "seen.txt")
+	crawl := func() []string {
+		mu.Lock()
+		fetched = nil
+		mu.Unlock()
+		crawlWith(t, Config{Depth: 2, Options: map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false",
+			"seen-db": db}}, srv.URL+"/")
+		sort.Strings(fetched)
+		return fetched
+	}
+
+	if got := crawl(); !slices.Equal(got, []string{"/", "/a"}) {
+		t.Errorf("the first run fetched %v, want / and /a", got)
+	}
+
+	// the second run skips /a, which the first run crawled, but crawls the new page
+	mu.Lock()
+	links += `<a href="/b">b</a>`
+	mu.Unlock()
+	if got := crawl(); !slices.Equal(got, []string{"/", "/b"}) {
+		t.Errorf("the second run fetched %v, want / and only the new /b", got)
+	}
+}
+
+// Write a client certificate, signed by a new certificate authority, and its key as PEM files in dir.
+// It returns the authority, to verify the certificate with.
+func writeClientCert(t *testing.T, dir string) *x509.CertPool {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Test CA"}, IsCA: true,
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca, err = x509.ParseCertificate(caDER); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "crawler"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	certDER, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, block := range map[string]*pem.Block{"client.crt": {Type: "CERTIFICATE", Bytes: certDER},
+		"client.key": {Type: "EC PRIVATE KEY", Bytes: keyDER}} {
+		if err := os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool
+}
+
+func TestClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	pool := writeClientCert(t, dir)
+
+	// the other server asks for a certificate without requiring it, to see whether it gets one
+	var mu sync.Mutex
+	presented := map[string]bool{}
+	other := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		presented[r.URL.Path] = len(r.TLS.PeerCertificates) > 0
+		mu.Unlock()
+	}))
+	other.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	other.StartTLS()
+	defer other.Close()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintf(w, `<html><title>Internal</title><a href="%s/other">other</a>`,
+				strings.Replace(other.URL, "127.0.0.1", "localhost", 1))
+		}
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, withCert := range []bool{true, false} {
+		options := map[string]string{"respect_robots": "false", "fail-fast-on-seed": "false", "insecure": "true"}
+		if withCert {
+			options["client-cert"], options["client-key"] = filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+		}
+		f := fetcher{}
+		crawlWith(t, Config{Depth: 2, Fetcher: f, Options: options}, srv.URL+"/")
+
+		if r := f[srv.URL+"/"]; r == nil || (r.status == 200) != withCert {
+			t.Errorf("got the page %+v with a client certificate: %v", r, withCert)
+		}
+	}
+
+	// the certificate is only presented to the host of the start URL
+	if got, ok := presented["/other"]; !ok || got {
+		t.Errorf("the other host was crawled: %v, and got the certificate: %v", ok, got)
+	}
+}
+
+func TestMixedContent(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><link rel="stylesheet" href="http://cdn.example.com/site.css">
+			<link rel="canonical" href="http://example.com/"><script src="https://cdn.example.com/app.js"></script></head>
+			<body><img src="http://images.example.com/logo.png" srcset="/logo-2x.png 2x, HTTP://images.example.com/logo-3x.png 3x">
+			<a href="http://example.com/old">a link is not loaded</a><img src="//images.example.com/relative.png">`)
+	}))
+	defer srv.Close()
+
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 1, Fetcher: f, Options: map[string]string{"respect_robots": "false", "insecure": "true"}},
+		srv.URL+"/")
+
+	// only the resources the page loads over http:// are mixed content, not the links or the canonical URL
+	want := []string{"http://cdn.example.com/site.css", "http://images.example.com/logo.png",
+		"http://images.example.com/logo-3x.png"}
+	if got := f[srv.URL+"/"].mixedContent; !slices.Equal(got, want) {
+		t.Errorf("got the mixed content %v, want %v", got, want)
+	}
+}
+
+func TestSrcset(t *testing.T) {
+	for srcset, want := range map[string][]image{
+		"a.jpg":              {{"a.jpg", ""}},
+		"a.jpg 1x, b.jpg 2x": {{"a.jpg", "1x"}, {"b.jpg", "2x"}},
+		"a.jpg,b.jpg 2x":     {{"a.jpg,b.jpg", "2x"}},
+		"a.jpg,, b.jpg 480w": {{"a.jpg", ""}, {"b.jpg", "480w"}},
+		"\n  small.jpg  320w,\n\tlarge.jpg 1024w  ": {{"small.jpg", "320w"}, {"large.jpg", "1024w"}},
+		"data:image/png;base64,iVBOR= 1x, b.jpg 2x": {{"data:image/png;base64,iVBOR=", "1x"}, {"b.jpg", "2x"}},
+		"a.jpg (max-width: 600px, 2x), b.jpg 3x":    {{"a.jpg", "(max-width: 600px, 2x)"}, {"b.jpg", "3x"}},
+		" , ,":                                      {},
+	} {
+		if got := parseSrcset(srcset); !slices.Equal(got, want) {
+			t.Errorf("parseSrcset(%q) = %v, want %v", srcset, got, want)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><img src="photo.jpg" srcset="photo-640.jpg 640w, /img/photo-1280.jpg 1280w,
+			https://cdn.example.com/photo-2x.jpg 2x"><picture><source srcset="photo.webp 1x, photo@2x.webp 2x"></picture>`)
+	}))
+	defer srv.Close()
+
+	// every candidate is recorded, resolved against the page
+	f := fetcher{}
+	crawlWith(t, Config{Depth: 1, Fetcher: f, Options: map[string]string{"respect_robots": "false", "extract-images": "true"}},
+		srv.URL+"/gallery/index.html")
+	want := []image{{srv.URL + "/gallery/photo.jpg", ""}, {srv.URL + "/gallery/photo-640.jpg", "640w"},
+		{srv.URL + "/img/photo-1280.jpg", "1280w"}, {"https://cdn.example.com/photo-2x.jpg", "2x"},
+		{srv.URL + "/gallery/photo.webp", "1x"}, {srv.URL + "/gallery/photo@2x.webp", "2x"}}
+	if got := f[srv.URL+"/gallery/index.html"].images; !slices.Equal(got, want) {
+		t.Errorf("got the images %v, want %v", got, want)
+	}
+}
+
+func TestRobotsSitemaps(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\n\nsitemap: %[1]s/index.xml\nSITEMAP:%[1]s/news.xml\n", srv.URL)
+		case "/index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/pages.xml</loc></sitemap></sitemapindex>`, srv.URL)
+		case "/pages.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%[1]s/about</loc></url><url><loc>%[1]s/private/x</loc></url></urlset>`, srv.URL)
+		case "/news.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/news/1</loc></url></urlset>`, srv.URL)
+		default:
+			fmt.Fprint(w, `<html><title>A page</title>`)
+		}
+	}))
+	defer srv.Close()
+
+	// the pages of every sitemap in robots.txt are crawled, also through a sitemap index, and robots.txt still applies
+	for _, discover := range []bool{false, true} {
+		result := crawlWith(t, Config{Depth: 2, Options: map[string]string{"robots-sitemaps": fmt.Sprint(discover)}},
+			srv.URL+"/")
+		for _, path := range []string{"/about", "/news/1"} {
+			if _, ok := result.Pages[srv.URL+path]; ok != discover {
+				t.Errorf("%s crawled: %v with --robots-sitemaps=%v", path, ok, discover)
+			}
+		}
+		if _, ok := result.Pages[srv.URL+"/private/x"]; ok {
+			t.Errorf("the page disallowed by robots.txt was crawled")
+		}
+	}
+}
+
+func TestBrokenOffBody(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		first := requests[r.URL.Path] == 1
+		mu.Unlock()
+
+		body := `<html><title>Flaky</title><a href="/a">a</a>` + strings.Repeat(" ", 100) + `<a href="/b">b</a>`
+		if r.URL.Path != "/flaky" || !first {
+			fmt.Fprint(w, body)
+			return
+		}
+		// the first response promises the whole page, but the connection breaks halfway
+		conn, buf, _ := w.(http.Hijacker).Hijack()
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: %d\r\n\r\n%s", len(body), body[:60])
+		buf.Flush()
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	for _, retries := range []int{0, 1} {
+		requests = map[string]int{}
+		f := fetcher{}
+		crawlWith(t, Config{Depth: 1, Fetcher: f, Options: map[string]string{"respect_robots": "false",
+			"retries": fmt.Sprint(retries)}}, srv.URL+"/flaky")
+
+		// without a retry the page is marked as truncated, with the links read until the connection broke
+		r := f[srv.URL+"/flaky"]
+		if retries == 0 && (r == nil || !r.truncated || r.err == nil || len(r.links) != 1) {
+			t.Errorf("got the page %+v without retries, want it truncated after the link to /a", r)
+		}
+		if retries == 1 && (r == nil || r.truncated || r.err != nil || len(r.links) != 2 || requests["/flaky"] != 2) {
+			t.Errorf("got the page %+v after %d requests with a retry, want all of it from the second", r, requests["/flaky"])
+		}
+	}
+}
+
+func TestOutputURLs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><title>Home</title><a href="/b#top">b</a><a href="/a">a</a><a href="/missing">missing</a>`)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprint(w, `<html><title>Page</title>`)
+		}
+	}))
+	defer srv.Close()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	if os.Stderr, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0); err != nil {
+		t.Fatal(err)
+	}
+	printed := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		printed <- b
+	}()
+
+	// stdout only has the URLs of the pages that were crawled without an error, one per line
+	Main([]string{"--url=" + srv.URL + "/", "--depth=2", "--respect_robots=false", "--quiet", "--output=urls", "--sort-urls"})
+	w.Close()
+
+	want := fmt.Sprintf("%[1]s/\n%[1]s/a\n%[1]s/b\n", srv.URL)
+	if got := string(<-printed); got != want {
+		t.Errorf("got the output %q, want %q", got, want)
+	}
+}
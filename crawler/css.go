@@ -0,0 +1,146 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The references in a stylesheet: url(...) values, which also covers @import url(...), and @import "..."
+var cssURLPattern = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+var cssImportPattern = regexp.MustCompile(`@import\s+['"]([^'"]+)['"]`)
+
+// Extensions of the resources that stylesheets usually refer to, which we never want to crawl
+var cssAssets = []string{".css", ".woff", ".woff2", ".ttf", ".otf", ".eot", ".svg", ".webp", ".ico"}
+
+// The references of the stylesheets read so far, by URL, so every stylesheet is fetched once per crawl however many
+// pages link to it. Reset by reset.
+var cssCache = struct {
+	sync.Mutex
+	sheets map[string]*cssSheet
+}{sheets: map[string]*cssSheet{}}
+
+// A stylesheet in the cssCache, which is read once by the first page that needs it while the others wait
+type cssSheet struct {
+	once sync.Once
+	refs []string
+}
+
+// Fetch the stylesheet at cssURL and return the pages it refers to. Stylesheets it imports are read as well.
+// Images, fonts and other assets are left out, so only URLs that look like HTML pages remain.
+func cssLinks(cssURL string) []string {
+	urls := []string{}
+	seen := map[string]bool{cssURL: true}
+	queue := []string{cssURL}
+
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+
+		for _, ref := range cachedCSSRefs(u) {
+			ref, ok := resolve(u, ref)
+			if !ok || seen[ref] || !strings.HasPrefix(ref, "http") {
+				continue
+			}
+			seen[ref] = true
+
+			switch {
+			case hasSuffix(ref, ".css"):
+				queue = append(queue, ref)
+			case !isFile(ref):
+				urls = append(urls, ref)
+			}
+		}
+	}
+
+	return urls
+}
+
+// The references in a stylesheet, from the cssCache or else fetched now
+func cachedCSSRefs(cssURL string) []string {
+	cssCache.Lock()
+	sheet, ok := cssCache.sheets[cssURL]
+	if !ok {
+		sheet = &cssSheet{}
+		cssCache.sheets[cssURL] = sheet
+	}
+	cssCache.Unlock()
+
+	sheet.once.Do(func() { sheet.refs = fetchCSSRefs(cssURL) })
+	return sheet.refs
+}
+
+// Fetch a stylesheet and return the references that the cssParser finds in it, as they are written, so possibly
+// relative. It is fetched like a page: robots.txt, --delay and --max-per-host apply, and not after the crawl
+// was aborted.
+func fetchCSSRefs(cssURL string) []string {
+	if crawlAborted() != nil || !robotsAllowed(cssURL) {
+		return nil
+	}
+	waitCrawlDelay(cssURL)
+	done := waitHostTurn(cssURL)
+	defer done()
+	if crawlAborted() != nil {
+		return nil
+	}
+
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	req, err := newRequest(ctx, cssURL)
+	if err != nil {
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	links, err := cssParser{}.Parse(cssURL, io.LimitReader(resp.Body, *maxBodySize))
+	if err != nil {
+		return nil
+	}
+
+	refs := []string{}
+	for _, l := range links {
+		refs = append(refs, l.URL)
+	}
+	return refs
+}
+
+// The references in a stylesheet as they are written, so possibly relative. Inline data: URLs are left out.
+func cssRefs(css string) []string {
+	refs := []string{}
+	for _, m := range cssURLPattern.FindAllStringSubmatch(css, -1) {
+		if !strings.HasPrefix(m[1], "data:") {
+			refs = append(refs, m[1])
+		}
+	}
+	for _, m := range cssImportPattern.FindAllStringSubmatch(css, -1) {
+		refs = append(refs, m[1])
+	}
+
+	return refs
+}
+
+// Whether the path of the URL ends in one of the extensions, ignoring the query and fragment
+func hasSuffix(u string, exts ...string) bool {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+
+	for _, ext := range exts {
+		if strings.HasSuffix(strings.ToLower(u), ext) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,221 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Write the crawl to w in one of the --format formats other than text: json, csv or sitemap.
+// Every format has the pages sorted by URL, so the same crawl gives the same output.
+func exportResults(w io.Writer, format string, f fetcher, depths map[string]int, s Stats) error {
+	switch format {
+	case "json":
+		return exportJSON(w, f, depths, s)
+	case "csv":
+		return exportCSV(w, f, depths)
+	case "sitemap":
+		return exportSitemap(w, f)
+	}
+
+	return fmt.Errorf("unknown format %s", format)
+}
+
+// An exportReporter writes the crawl to w in one of the --format formats other than text when it is finished. These
+// formats have the pages sorted by URL, with their depths and parents, so it keeps the pages it gets until then, also
+// with --stream-output. For a sitemap it only keeps what decides whether a page is listed.
+type exportReporter struct {
+	w      io.Writer
+	format string
+	pages  fetcher
+}
+
+func newExportReporter(w io.Writer, format string) *exportReporter {
+	return &exportReporter{w, format, fetcher{}}
+}
+
+func (e *exportReporter) Page(url string, r *result) {
+	if e.format == "sitemap" {
+		r = &result{status: r.status, old: r.old, err: r.err, redirects: r.redirects}
+	}
+	e.pages[url] = r
+}
+
+func (e *exportReporter) Finish(s Stats, depths map[string]int) error {
+	return exportResults(e.w, e.format, e.pages, depths, s)
+}
+
+// The JSON document written with --format=json
+type jsonCrawl struct {
+	StartURL   string                     `json:"start_url"`
+	Pages      int                        `json:"pages"`
+	UniqueURLs int                        `json:"unique_urls"`
+	Results    map[string]jsonCrawlResult `json:"results"`
+
+	// the titles shared by more than one page, with --duplicate-titles
+	DuplicateTitles map[string][]string `json:"duplicate_titles,omitempty"`
+}
+
+// A crawled page in the JSON document, with the links found on it, its Open Graph and Twitter Card properties, and
+// what the extractors of --extract found
+type jsonCrawlResult struct {
+	Title       string            `json:"title"`
+	Status      int               `json:"status"`
+	Depth       int               `json:"depth"`
+	Parent      string            `json:"parent,omitempty"`
+	Links       []jsonLink        `json:"links"`
+	Error       string            `json:"error,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Canonical   string            `json:"canonical,omitempty"`
+	Headings    []jsonHeading     `json:"headings,omitempty"`
+	Images      []jsonImage       `json:"images,omitempty"`
+	Media       []string          `json:"media,omitempty"`
+	Assets      []string          `json:"assets,omitempty"`
+	OpenGraph   map[string]string `json:"open_graph,omitempty"`
+	Twitter     map[string]string `json:"twitter,omitempty"`
+}
+
+// Write the crawl as one JSON document. The results are keyed by URL, which encoding/json writes in sorted order.
+func exportJSON(w io.Writer, f fetcher, depths map[string]int, s Stats) error {
+	parents := parentsOf(f, depths)
+
+	doc := jsonCrawl{StartURL: *startURL, Pages: s.Pages, UniqueURLs: s.URLs, Results: map[string]jsonCrawlResult{}}
+	if *reportDuplicateTitles {
+		doc.DuplicateTitles = duplicateTitles(f)
+	}
+	for url, r := range f {
+		p := jsonCrawlResult{Title: r.title, Status: r.status, Depth: depthOf(url, depths), Parent: parents[url],
+			Links: []jsonLink{}, Description: r.description, Canonical: r.canonical, Media: r.media, Assets: r.assets,
+			OpenGraph: r.openGraph, Twitter: r.twitter}
+		for _, h := range r.headings {
+			p.Headings = append(p.Headings, jsonHeading{h.level, h.text})
+		}
+		for _, i := range r.images {
+			p.Images = append(p.Images, jsonImage{i.url, i.descriptor})
+		}
+		for _, l := range r.links {
+			p.Links = append(p.Links, jsonLink{l.url, l.rel, l.typ, l.text})
+		}
+		if r.err != nil {
+			p.Error = r.err.Error()
+		}
+		doc.Results[url] = p
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Write the crawl as CSV with a header row, and a row for every page with its URL, title, status, depth, parent
+// and the URLs found on it, separated by spaces. The rel and type attributes of the links follow in the same order,
+// separated by |, since a rel can have several values separated by spaces itself.
+func exportCSV(w io.Writer, f fetcher, depths map[string]int) error {
+	parents := parentsOf(f, depths)
+
+	c := csv.NewWriter(w)
+	c.Write([]string{"url", "title", "status", "depth", "parent", "links", "rels", "types"})
+	for _, url := range f.sortedURLs() {
+		r := f[url]
+
+		links, rels, types := []string{}, []string{}, []string{}
+		for _, l := range r.links {
+			links = append(links, l.url)
+			rels = append(rels, l.rel)
+			types = append(types, l.typ)
+		}
+
+		c.Write([]string{url, r.title, strconv.Itoa(r.status), strconv.Itoa(depthOf(url, depths)), parents[url],
+			strings.Join(links, " "), strings.Join(rels, "|"), strings.Join(types, "|")})
+	}
+
+	c.Flush()
+	return c.Error()
+}
+
+// The sitemap written with --format=sitemap, see https://www.sitemaps.org/protocol.html
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapLoc `xml:"url"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// Write a sitemap of the pages that were crawled without an error or a redirect, so it only lists pages that
+// really are there under their own URL. Local files are left out, since a sitemap is for a web site.
+func exportSitemap(w io.Writer, f fetcher) error {
+	s := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, url := range f.sortedURLs() {
+		r := f[url]
+		if r.err != nil || len(r.redirects) > 0 || (!r.old && (r.status < 200 || r.status > 299)) {
+			continue
+		}
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue
+		}
+		s.URLs = append(s.URLs, sitemapLoc{url})
+	}
+
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// The depth at which url was found, or -1 when it is not known, like with --approx-dedup
+func depthOf(url string, depths map[string]int) int {
+	if d, ok := depths[url]; ok {
+		return d
+	}
+	return -1
+}
+
+// The parent of every crawled page: a page one level closer to the start URL that links to it. When several
+// pages do, the first one by URL is taken, so the parents are the same for the same crawl.
+// The start URL and the pages whose depth is not known have no parent.
+func parentsOf(f fetcher, depths map[string]int) map[string]string {
+	parents := map[string]string{}
+
+	for _, url := range f.sortedURLs() {
+		d, ok := depths[url]
+		if !ok {
+			continue
+		}
+
+		for _, l := range f[url].links {
+			target := normalizeURL(l.url)
+			if _, crawled := f[target]; !crawled || parents[target] != "" || target == url {
+				continue
+			}
+			if td, ok := depths[target]; ok && td == d+1 {
+				parents[target] = url
+			}
+		}
+	}
+
+	return parents
+}
+
+// The URLs of the crawled pages, sorted
+func (f fetcher) sortedURLs() []string {
+	urls := []string{}
+	for url := range f {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	return urls
+}
@@ -0,0 +1,52 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The extractors that --extract can turn on, each of which records more of every page:
+//
+//	meta      the meta description and the canonical URL
+//	assets    the URLs of the scripts, stylesheets and images the page loads
+//	headings  the outline of h1-h6 headings, like --extract-headings
+//	images    the images with every candidate of their srcset, like --extract-images
+//	media     the audio and video, like --extract-media
+var extractorNames = []string{"meta", "assets", "headings", "images", "media"}
+
+// The extractors that were turned on before --extract existed, with a flag of their own
+var extractorFlags = map[string]*bool{"headings": extractHeadings, "images": extractImages, "media": extractMedia}
+
+// The extractors turned on with --extract. Set by setup.
+var extractors map[string]bool
+
+// Set up the extractors from the comma separated names of --extract
+func setupExtractors() error {
+	extractors = map[string]bool{}
+
+	for _, name := range strings.Split(*extractFlag, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+
+		known := false
+		for _, n := range extractorNames {
+			known = known || n == name
+		}
+		if !known {
+			return fmt.Errorf("unknown extractor %q in --extract, it must be one of %s", name, strings.Join(extractorNames, ", "))
+		}
+		extractors[name] = true
+	}
+
+	return nil
+}
+
+// Whether the extractor is turned on, with --extract or with its own flag
+func extracting(name string) bool {
+	if f, ok := extractorFlags[name]; ok && *f {
+		return true
+	}
+
+	return extractors[name]
+}
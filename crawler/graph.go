@@ -0,0 +1,195 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The formats of --graph-format
+var graphFormats = []string{"dot", "graphml", "jsonl"}
+
+// A graphReporter records the link graph of the crawl while the pages come in, for --graph and --output=graphml:
+// every crawled page with its title and status, and an edge from it to every URL it links to. It keeps nothing else
+// of the pages, so it also works with --stream-output, where the pages are not kept in memory. When the crawl is
+// finished, it writes the graph to the file at path in the format, which is one of graphFormats.
+type graphReporter struct {
+	path   string
+	format string
+	pages  map[string]graphPage
+	edges  []graphEdge
+}
+
+type graphPage struct {
+	title  string
+	status int
+}
+
+// An edge from a crawled page to a URL it links to. It is internal when the URL is on the host of the start URL,
+// like --same_host decides.
+type graphEdge struct {
+	source   string
+	target   string
+	internal bool
+}
+
+func newGraphReporter(path, format string) *graphReporter {
+	return &graphReporter{path: path, format: format, pages: map[string]graphPage{}}
+}
+
+func (g *graphReporter) Page(url string, r *result) {
+	g.pages[url] = graphPage{r.title, r.status}
+
+	// a page that links to the same URL twice has one edge to it
+	seen := map[string]bool{}
+	for _, l := range r.links {
+		target := normalizeURL(l.url)
+		if !seen[target] {
+			seen[target] = true
+			g.edges = append(g.edges, graphEdge{url, target, sameHostAs(target)})
+		}
+	}
+}
+
+func (g *graphReporter) Finish(_ Stats, depths map[string]int) error {
+	return g.write(g.path, g.format, depths)
+}
+
+// The crawled pages and the URLs they link to, sorted
+func (g *graphReporter) nodes() []string {
+	urls := map[string]bool{}
+	for url := range g.pages {
+		urls[url] = true
+	}
+	for _, e := range g.edges {
+		urls[e.target] = true
+	}
+
+	sorted := []string{}
+	for url := range urls {
+		sorted = append(sorted, url)
+	}
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// Write the link graph to the file at path in the format, which is one of graphFormats. The depth of an edge is
+// the depth of the page the link is on.
+func (g *graphReporter) write(path, format string, depths map[string]int) error {
+	// the pages came in as they were crawled, so sort the edges by their page to write the same file for the same crawl
+	sort.SliceStable(g.edges, func(i, j int) bool { return g.edges[i].source < g.edges[j].source })
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	switch format {
+	case "dot":
+		g.writeDOT(w, depths)
+	case "graphml":
+		err = g.writeGraphML(w, depths)
+	case "jsonl":
+		err = g.writeJSONL(w, depths)
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Write the graph in the DOT language of Graphviz, with the title as the label of a crawled page, and the links to
+// other sites dashed
+func (g *graphReporter) writeDOT(w io.Writer, depths map[string]int) {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ", "\r", " ")
+
+	fmt.Fprintln(w, "digraph crawl {")
+	for _, url := range g.nodes() {
+		label := url
+		if p, ok := g.pages[url]; ok && p.title != "" {
+			label = p.title
+		}
+		fmt.Fprintf(w, "  \"%s\" [label=\"%s\", depth=%d, status=%d];\n", quote.Replace(url), quote.Replace(label),
+			depthOf(url, depths), g.status(url))
+	}
+	for _, e := range g.edges {
+		style := "solid"
+		if !e.internal {
+			style = "dashed"
+		}
+		fmt.Fprintf(w, "  \"%s\" -> \"%s\" [depth=%d, internal=%t, style=%s];\n", quote.Replace(e.source),
+			quote.Replace(e.target), depthOf(e.source, depths), e.internal, style)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// Write the graph as GraphML, for --output=graphml and --graph-format=graphml. Every crawled page and every URL found
+// on one is a node with its url, title, depth and status (the last two are -1 when unknown), and every link is an
+// edge with the depth of its page and whether it is internal.
+func (g *graphReporter) writeGraphML(w io.Writer, depths map[string]int) error {
+	doc := newGraphML()
+	doc.Keys = append(doc.Keys,
+		graphMLKey{"edge-depth", "edge", "depth", "int"},
+		graphMLKey{"internal", "edge", "internal", "boolean"},
+	)
+
+	ids := map[string]string{}
+	for i, url := range g.nodes() {
+		ids[url] = fmt.Sprintf("n%d", i)
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ids[url], []graphMLData{
+			{"url", url},
+			{"title", g.pages[url].title},
+			{"depth", fmt.Sprint(depthOf(url, depths))},
+			{"status", fmt.Sprint(g.status(url))},
+		}})
+	}
+	for _, e := range g.edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{ids[e.source], ids[e.target], []graphMLData{
+			{"edge-depth", fmt.Sprint(depthOf(e.source, depths))},
+			{"internal", fmt.Sprint(e.internal)},
+		}})
+	}
+
+	return doc.write(w)
+}
+
+// One line of JSON for every edge of the graph with --graph-format=jsonl
+type jsonEdge struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Depth    int    `json:"depth"`
+	Internal bool   `json:"internal"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+}
+
+// Write every edge of the graph as a line of JSON, with the title and status of the page the link is on
+func (g *graphReporter) writeJSONL(w io.Writer, depths map[string]int) error {
+	enc := json.NewEncoder(w)
+	for _, e := range g.edges {
+		p := g.pages[e.source]
+		if err := enc.Encode(jsonEdge{e.source, e.target, depthOf(e.source, depths), e.internal, p.title, p.status}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The status of a URL, or -1 when it was not crawled
+func (g *graphReporter) status(url string) int {
+	if p, ok := g.pages[url]; ok {
+		return p.status
+	}
+	return -1
+}
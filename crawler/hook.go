@@ -0,0 +1,30 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// The slots for running --on-page commands, so at most --on-page-concurrency of them run at once. Set by setup.
+var onPageSlots chan bool
+
+// Run the --on-page command for a page: the shell runs it with the URL as $1 and in $GOCRAWLER_URL,
+// and with the body of the page on stdin. Its output goes to commandOutput and our stderr.
+func runOnPage(url string, body []byte) error {
+	onPageSlots <- true
+	defer func() { <-onPageSlots }()
+
+	cmd := exec.Command("sh", "-c", *onPage, "sh", url)
+	cmd.Env = append(os.Environ(), "GOCRAWLER_URL="+url)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = commandOutput
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("--on-page command failed for %s: %v", url, err)
+	}
+
+	return nil
+}
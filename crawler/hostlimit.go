@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+)
+
+// The limits of --delay and --max-per-host for every host we crawled, by host (with the port, if any)
+var hostLimits = struct {
+	sync.Mutex
+	hosts map[string]*hostLimit
+}{hosts: map[string]*hostLimit{}}
+
+// A hostLimit has the slots for the pages of a host that are being fetched, so at most --max-per-host of them are
+// fetched at once, and when the next page of the host may be fetched because of --delay
+type hostLimit struct {
+	slots chan bool
+	sync.Mutex
+	next time.Time
+}
+
+// Wait until the page at u may be fetched: until fewer than --max-per-host pages of its host are being fetched, and
+// --delay has passed since the previous page of the host was started. Other hosts are not held up by it, they have
+// their own turns. An aborted crawl stops waiting for --delay, so check whether it was aborted before fetching the page.
+// Call the returned function when the page is fetched, to give its slot to the next page of the host.
+// Unlike waitCrawlDelay, this applies to every fetcher and to every URL, including local files.
+func waitHostTurn(u string) (done func()) {
+	if *politeDelay <= 0 && *maxPerHost <= 0 {
+		return func() {}
+	}
+
+	h := limitOf(hostOf(u))
+
+	if h.slots != nil {
+		h.slots <- true
+	}
+
+	if *politeDelay > 0 {
+		h.Lock()
+		turn := h.next
+		if now := time.Now(); turn.Before(now) {
+			turn = now
+		}
+		h.next = turn.Add(*politeDelay)
+		h.Unlock()
+
+		sleepUnlessAborted(time.Until(turn))
+	}
+
+	return func() {
+		if h.slots != nil {
+			<-h.slots
+		}
+	}
+}
+
+// The limits of a host, created at its first page
+func limitOf(host string) *hostLimit {
+	hostLimits.Lock()
+	defer hostLimits.Unlock()
+
+	h := hostLimits.hosts[host]
+	if h == nil {
+		h = &hostLimit{}
+		if *maxPerHost > 0 {
+			h.slots = make(chan bool, *maxPerHost)
+		}
+		hostLimits.hosts[host] = h
+	}
+
+	return h
+}
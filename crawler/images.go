@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// An image is the URL of an image on a page, with the descriptor of its srcset candidate (e.g. 2x or 640w),
+// which is empty for the src of an <img>
+type image struct {
+	url        string
+	descriptor string
+}
+
+// The images an element loads: the src and every srcset candidate of an <img>, and the srcset candidates of
+// the <source> elements of a <picture>. The URLs are resolved against the URL of the page, base.
+func imagesOf(base string, t html.Token) []image {
+	if t.Data != "img" && t.Data != "source" {
+		return nil
+	}
+
+	images := []image{}
+	for _, a := range t.Attr {
+		switch {
+		case a.Key == "src" && t.Data == "img":
+			if u, ok := resolve(base, a.Val); ok && strings.TrimSpace(a.Val) != "" {
+				images = append(images, image{url: u})
+			}
+		case a.Key == "srcset":
+			for _, c := range parseSrcset(a.Val) {
+				if u, ok := resolve(base, c.url); ok {
+					images = append(images, image{u, c.descriptor})
+				}
+			}
+		}
+	}
+
+	return images
+}
+
+// Split a srcset attribute into its candidates, following the HTML spec: a candidate is a URL, which may
+// contain commas but not end with one, followed by an optional descriptor, up to a comma outside of parentheses.
+// e.g. "a.jpg 1x, b,c.jpg 2x" has the candidates a.jpg (1x) and b,c.jpg (2x).
+func parseSrcset(srcset string) []image {
+	candidates := []image{}
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' }
+
+	i := 0
+	for i < len(srcset) {
+		// skip the whitespace and commas before the URL
+		for i < len(srcset) && (isSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+		if i == len(srcset) {
+			break
+		}
+
+		start := i
+		for i < len(srcset) && !isSpace(srcset[i]) {
+			i++
+		}
+		url := srcset[start:i]
+
+		// a URL that ends with commas has no descriptor, the commas separate it from the next candidate
+		if strings.HasSuffix(url, ",") {
+			candidates = append(candidates, image{strings.TrimRight(url, ","), ""})
+			continue
+		}
+
+		// the descriptor runs to the next comma, unless that comma is inside parentheses
+		start = i
+		depth := 0
+		for i < len(srcset) && (srcset[i] != ',' || depth > 0) {
+			switch srcset[i] {
+			case '(':
+				depth++
+			case ')':
+				if depth > 0 {
+					depth--
+				}
+			}
+			i++
+		}
+		candidates = append(candidates, image{url, strings.Join(strings.Fields(srcset[start:i]), " ")})
+	}
+
+	return candidates
+}
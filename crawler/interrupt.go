@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The reason a crawl that was stopped with Ctrl-C was aborted
+var errInterrupted = errors.New("interrupted")
+
+// The reason the crawl was aborted, nil while it goes on. Ctx is cancelled when it is aborted, which stops the
+// requests that are being made and wakes up the crawlers that are waiting for their turn. Reset by reset.
+var abort = newAbortState()
+
+type abortState struct {
+	sync.Mutex
+	err    error
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+func newAbortState() *abortState {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &abortState{ctx: ctx, cancel: cancel}
+}
+
+// The context of a crawl from the command line, which is done when we get SIGINT (Ctrl-C) or SIGTERM, or when
+// --max-duration has passed. The requests that are being made are stopped then, and the results so far are
+// written. After the first signal the default handling is back, so a second Ctrl-C quits at once. Call cancel when the crawl is finished, to stop listening for signals.
+func crawlContext() (ctx context.Context, cancel context.CancelFunc) {
+	interrupted, cancelCause := context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "\nInterrupted, writing the pages crawled so far (press Ctrl-C again to quit)")
+			cancelCause(errInterrupted)
+		case <-interrupted.Done():
+		}
+		signal.Stop(signals)
+	}()
+
+	if *maxDuration <= 0 {
+		return interrupted, func() { cancelCause(nil) }
+	}
+
+	ctx, cancelTimeout := context.WithTimeoutCause(interrupted, *maxDuration, fmt.Errorf("--max-duration of %v has passed", *maxDuration))
+	return ctx, func() {
+		cancelTimeout()
+		cancelCause(nil)
+	}
+}
+
+// Stop the crawl because of err: the requests that are being made are stopped, and no new ones are started.
+// The pages they were for are not recorded, so a resumed crawl fetches them.
+func abortCrawl(err error) {
+	abort.Lock()
+	defer abort.Unlock()
+
+	if abort.err == nil {
+		abort.err = err
+		abort.cancel(err)
+	}
+}
+
+// The reason the crawl was aborted, or nil when it was not
+func crawlAborted() error {
+	abort.Lock()
+	defer abort.Unlock()
+
+	return abort.err
+}
+
+// The context of the crawl, which is cancelled when the crawl is aborted
+func abortContext() context.Context {
+	abort.Lock()
+	defer abort.Unlock()
+
+	return abort.ctx
+}
+
+// The context of a request of the crawl, which ends after --timeout, or when the crawl is aborted
+func requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(abortContext(), *timeout)
+}
+
+// Wait for d, unless the crawl is aborted before that. It returns the reason the crawl was aborted, or nil.
+func sleepUnlessAborted(d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-abortContext().Done():
+		return crawlAborted()
+	}
+}
@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Retrieve the property and content of a <meta property="..." content="..."> tag. Some sites use name
+// instead of property for Open Graph tags, and Twitter uses name, so both are accepted. The property is lowercased.
+func metaProperty(t html.Token) (property, content string) {
+	for _, a := range t.Attr {
+		switch a.Key {
+		case "property", "name":
+			if property == "" {
+				property = strings.ToLower(strings.TrimSpace(a.Val))
+			}
+		case "content":
+			content = strings.TrimSpace(a.Val)
+		}
+	}
+
+	return property, content
+}
+
+// Record the meta tag of a page in the Open Graph (og:*) or Twitter Card (twitter:*) properties of the page.
+// Properties can be repeated, e.g. for several images, of which the first one counts.
+func addSocialMeta(t html.Token, openGraph, twitter map[string]string) {
+	property, content := metaProperty(t)
+	if content == "" {
+		return
+	}
+
+	var m map[string]string
+	switch {
+	case strings.HasPrefix(property, "og:"):
+		m = openGraph
+	case strings.HasPrefix(property, "twitter:"):
+		m = twitter
+	default:
+		return
+	}
+
+	if _, ok := m[property]; !ok {
+		m[property] = content
+	}
+}
+
+// The content of a <meta name="description"> tag, or "" when t is another meta tag
+func metaDescription(t html.Token) string {
+	property, content := metaProperty(t)
+	if property != "description" {
+		return ""
+	}
+
+	return content
+}
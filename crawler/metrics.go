@@ -0,0 +1,199 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The live counters of the running crawl, for --progress and --metrics-addr. The workers update them concurrently,
+// so the totals are atomic and the pages per depth are only changed while holding the lock.
+type crawlMetrics struct {
+	crawled     atomic.Int64
+	queued      atomic.Int64
+	errors      atomic.Int64
+	bytes       atomic.Int64
+	transferred atomic.Int64
+
+	sync.Mutex
+	started time.Time
+	depths  map[int]int64
+}
+
+var liveMetrics = &crawlMetrics{depths: map[int]int64{}}
+
+// Start counting afresh, for a crawl that starts now
+func (m *crawlMetrics) begin() {
+	m.crawled.Store(0)
+	m.queued.Store(0)
+	m.errors.Store(0)
+	m.bytes.Store(0)
+	m.transferred.Store(0)
+
+	m.Lock()
+	m.started = time.Now()
+	m.depths = map[int]int64{}
+	m.Unlock()
+}
+
+// Count a page at the given depth that was fetched, with the error of the fetcher
+func (m *crawlMetrics) page(depth int, err error) {
+	m.crawled.Add(1)
+	if err != nil {
+		m.errors.Add(1)
+	}
+
+	m.Lock()
+	m.depths[depth]++
+	m.Unlock()
+}
+
+// The metrics of the crawl at one moment. The depths have the number of pages crawled at every depth.
+type metricsSnapshot struct {
+	Crawled        int64         `json:"crawled"`
+	Queued         int64         `json:"queued"`
+	Errors         int64         `json:"errors"`
+	PagesPerSecond float64       `json:"pages_per_second"`
+	Bytes          int64         `json:"bytes"`
+	Transferred    int64         `json:"transferred"`
+	Depths         map[int]int64 `json:"depths"`
+	Elapsed        float64       `json:"elapsed_seconds"`
+}
+
+func (m *crawlMetrics) snapshot() metricsSnapshot {
+	s := metricsSnapshot{
+		Crawled:     m.crawled.Load(),
+		Queued:      m.queued.Load(),
+		Errors:      m.errors.Load(),
+		Bytes:       m.bytes.Load(),
+		Transferred: m.transferred.Load(),
+		Depths:      map[int]int64{},
+	}
+
+	m.Lock()
+	for d, n := range m.depths {
+		s.Depths[d] = n
+	}
+	if !m.started.IsZero() {
+		s.Elapsed = time.Since(m.started).Seconds()
+	}
+	m.Unlock()
+
+	if s.Elapsed > 0 {
+		s.PagesPerSecond = float64(s.Crawled) / s.Elapsed
+	}
+
+	return s
+}
+
+// The depths of the snapshot in increasing order
+func (s metricsSnapshot) sortedDepths() []int {
+	depths := []int{}
+	for d := range s.Depths {
+		depths = append(depths, d)
+	}
+	sort.Ints(depths)
+
+	return depths
+}
+
+// The snapshot as one line for --progress, e.g.
+// crawled 120, queued 30, errors 2, 4.1 pages/s, 1048576 bytes, depths 0:1 1:20 2:99
+func (s metricsSnapshot) String() string {
+	line := fmt.Sprintf("crawled %d, queued %d, errors %d, %.1f pages/s, %d bytes",
+		s.Crawled, s.Queued, s.Errors, s.PagesPerSecond, s.Bytes)
+
+	perDepth := []string{}
+	for _, d := range s.sortedDepths() {
+		perDepth = append(perDepth, fmt.Sprintf("%d:%d", d, s.Depths[d]))
+	}
+	if len(perDepth) > 0 {
+		line += ", depths " + strings.Join(perDepth, " ")
+	}
+
+	return line
+}
+
+// Write the snapshot to w in the Prometheus text format
+func (s metricsSnapshot) writePrometheus(w io.Writer) {
+	metric := func(name, typ, help string, value any) {
+		fmt.Fprintf(w, "# HELP gocrawler_%s %s\n# TYPE gocrawler_%s %s\ngocrawler_%s %v\n", name, help, name, typ, name, value)
+	}
+
+	metric("pages_crawled_total", "counter", "Pages crawled.", s.Crawled)
+	metric("urls_queued", "gauge", "URLs found that are waiting to be crawled.", s.Queued)
+	metric("errors_total", "counter", "Pages that could not be fetched.", s.Errors)
+	metric("pages_per_second", "gauge", "Pages crawled per second since the crawl started.", s.PagesPerSecond)
+	metric("bytes_read_total", "counter", "Bytes read from the pages.", s.Bytes)
+	metric("bytes_transferred_total", "counter", "Compressed bytes transferred for the pages.", s.Transferred)
+	metric("elapsed_seconds", "gauge", "Seconds since the crawl started.", s.Elapsed)
+
+	fmt.Fprintln(w, "# HELP gocrawler_depth_pages_crawled_total Pages crawled at every depth.")
+	fmt.Fprintln(w, "# TYPE gocrawler_depth_pages_crawled_total counter")
+	for _, d := range s.sortedDepths() {
+		fmt.Fprintf(w, "gocrawler_depth_pages_crawled_total{depth=\"%d\"} %d\n", d, s.Depths[d])
+	}
+}
+
+// Print the metrics to w every interval, until stop is called. The last line is printed by stop, so the totals
+// of the finished crawl are always shown.
+func printProgress(w io.Writer, interval time.Duration) (stop func()) {
+	done := make(chan bool)
+	printed := make(chan bool)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintln(w, "=== Progress:", liveMetrics.snapshot())
+			case <-done:
+				fmt.Fprintln(w, "=== Progress:", liveMetrics.snapshot())
+				close(printed)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-printed
+	}
+}
+
+// Serve the metrics on addr, at /metrics in the Prometheus text format and at /metrics.json as JSON, until stop
+// is called. It returns an error when it cannot listen on addr, so the crawl does not start unmonitored.
+func serveMetrics(addr string) (stop func(), err error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		liveMetrics.snapshot().writePrometheus(w)
+	})
+	mux.HandleFunc("/metrics.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(liveMetrics.snapshot())
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(l)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The attributes of the elements that load a resource into the page. A link only loads one with some rels.
+var resourceAttrs = map[string][]string{
+	"img":    {"src", "srcset"},
+	"script": {"src"},
+	"link":   {"href"},
+	"iframe": {"src"},
+	"audio":  {"src"},
+	"video":  {"src", "poster"},
+	"source": {"src", "srcset"},
+	"embed":  {"src"},
+	"object": {"data"},
+}
+
+// The rels of a <link> that load a resource, unlike e.g. rel="canonical" or rel="next"
+var resourceRels = []string{"stylesheet", "icon", "preload", "modulepreload", "manifest"}
+
+// The http:// resources that an element on the HTTPS page loads, which browsers block or warn about as mixed content
+func mixedContent(page string, t html.Token) []string {
+	attrs, ok := resourceAttrs[t.Data]
+	if !ok || !strings.HasPrefix(page, "https://") {
+		return nil
+	}
+
+	if t.Data == "link" {
+		rel := ""
+		for _, a := range t.Attr {
+			if a.Key == "rel" {
+				rel = strings.ToLower(a.Val)
+			}
+		}
+		loads := false
+		for _, r := range resourceRels {
+			loads = loads || strings.Contains(rel, r)
+		}
+		if !loads {
+			return nil
+		}
+	}
+
+	mixed := []string{}
+	for _, a := range t.Attr {
+		for _, key := range attrs {
+			if a.Key != key {
+				continue
+			}
+
+			// a srcset is a list of URLs, each followed by its size
+			refs := []string{a.Val}
+			if key == "srcset" {
+				refs = nil
+				for _, c := range parseSrcset(a.Val) {
+					refs = append(refs, c.url)
+				}
+			}
+
+			for _, ref := range refs {
+				if u, ok := resolve(page, ref); ok && strings.HasPrefix(strings.ToLower(u), "http://") {
+					mixed = append(mixed, u)
+				}
+			}
+		}
+	}
+
+	return mixed
+}
+
+// Print the HTTPS pages that load resources over http://, with those resources
+func printMixedContent(f fetcher) {
+	urls := []string{}
+	for url, result := range f {
+		if len(result.mixedContent) > 0 {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+
+	fmt.Fprintf(console, "\n=== Mixed content (%d pages)\n", len(urls))
+	for _, url := range urls {
+		fmt.Fprintf(console, "%v\n", url)
+		for _, u := range f[url].mixedContent {
+			fmt.Fprintf(console, "|-- %v\n", u)
+		}
+	}
+}
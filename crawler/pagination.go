@@ -0,0 +1,44 @@
+package crawler
+
+import "strings"
+
+// The number of rel="next" links that were followed in a row to reach a URL, used for --max-pagination.
+// Like the crawl history, the map is guarded by passing it through a channel.
+var paginationAccess = make(chan map[string]int, 1)
+
+func init() {
+	paginationAccess <- map[string]int{}
+}
+
+// The number of rel="next" links that were followed in a row to reach url, 0 if it was not reached through one
+func paginationChain(url string) int {
+	m := <-paginationAccess
+	chain := m[url]
+	paginationAccess <- m
+
+	return chain
+}
+
+// Remember that the URLs in next are one page further in the pagination chain than a page with the given chain length.
+// URLs that were seen before keep their chain length.
+func recordNext(chain int, next []string) {
+	m := <-paginationAccess
+	for _, u := range next {
+		u = normalizeURL(u)
+		if _, ok := m[u]; !ok {
+			m[u] = chain + 1
+		}
+	}
+	paginationAccess <- m
+}
+
+// Whether the rel attribute of the link contains the given link type, e.g. "next" in rel="next nofollow"
+func hasRel(l link, rel string) bool {
+	for _, r := range strings.Fields(l.rel) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+
+	return false
+}
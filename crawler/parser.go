@@ -0,0 +1,175 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Parser finds the links on pages of a content type that the crawler does not parse itself. It gets the URL of
+// the page after redirects, and its body, which is cut off at --max-body-size. The links may be relative to the URL.
+// An error means the page could not be parsed, and then none of its links are followed.
+type Parser interface {
+	Parse(url string, body io.Reader) ([]Link, error)
+}
+
+// The parsers registered with RegisterParser, by media type
+var registeredParsers = struct {
+	sync.Mutex
+	types map[string]Parser
+}{types: map[string]Parser{}}
+
+// RegisterParser makes the crawler parse the pages of the media type, e.g. "application/json", with p. Registering
+// a parser for a media type again replaces it. Pages of a media type without a parser are not read at all, except
+// HTML pages, which the crawler parses itself unless a parser is registered for text/html.
+// The parsers are used by the crawls that start after they are registered.
+func RegisterParser(mediaType string, p Parser) {
+	registeredParsers.Lock()
+	defer registeredParsers.Unlock()
+
+	registeredParsers.types[strings.ToLower(mediaType)] = p
+}
+
+// The built-in parsers that --parsers turns on, by their name, with the media types they are for
+var builtinParsers = map[string]struct {
+	types  []string
+	parser Parser
+}{
+	"css":  {[]string{"text/css"}, cssParser{}},
+	"json": {[]string{"application/json", "application/ld+json"}, jsonParser{}},
+	"text": {[]string{"text/plain"}, textParser{}},
+}
+
+// The parsers of the crawl by media type: the built-in ones of --parsers and the registered ones. Set by setup.
+var contentParsers map[string]Parser
+
+// Set up the parsers of the crawl from --parsers and the registered parsers, which take precedence
+func setupParsers() error {
+	contentParsers = map[string]Parser{}
+
+	for _, name := range strings.Split(*parsersFlag, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+
+		b, ok := builtinParsers[name]
+		if !ok {
+			names := []string{}
+			for n := range builtinParsers {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown parser %q in --parsers, it must be one of %s", name, strings.Join(names, ", "))
+		}
+		for _, t := range b.types {
+			contentParsers[t] = b.parser
+		}
+	}
+
+	registeredParsers.Lock()
+	for t, p := range registeredParsers.types {
+		contentParsers[t] = p
+	}
+	registeredParsers.Unlock()
+
+	return nil
+}
+
+// The media type of a response in lower case, like text/html, which is empty when the server does not send one
+func mediaTypeOf(resp *http.Response) string {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+// Whether the crawler parses pages of the media type itself. Pages without one are taken to be HTML, as they always were.
+func isHTML(mediaType string) bool {
+	return mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// A cssParser finds the url(...) and @import references of a stylesheet, leaving out its images and fonts
+type cssParser struct{}
+
+func (cssParser) Parse(url string, body io.Reader) ([]Link, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	links := []Link{}
+	for _, ref := range cssRefs(string(b)) {
+		if hasSuffix(ref, ".css") || !hasSuffix(ref, cssAssets...) {
+			links = append(links, Link{URL: ref})
+		}
+	}
+
+	return links, nil
+}
+
+// A jsonParser finds the absolute http(s) URLs among the strings of a JSON document. The text of every link is the
+// name of the field it is in.
+type jsonParser struct{}
+
+func (jsonParser) Parse(url string, body io.Reader) ([]Link, error) {
+	var doc interface{}
+	if err := json.NewDecoder(body).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	links := []Link{}
+	var walk func(v interface{}, field string)
+	walk = func(v interface{}, field string) {
+		switch v := v.(type) {
+		case string:
+			if strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
+				links = append(links, Link{URL: v, Text: field})
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e, field)
+			}
+		case map[string]interface{}:
+			// in the order of the fields, so the links come out the same every time
+			keys := []string{}
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(v[k], k)
+			}
+		}
+	}
+	walk(doc, "")
+
+	return links, nil
+}
+
+// The http(s) URLs in plain text, which end at white space, quotes or brackets
+var textURLPattern = regexp.MustCompile(`https?://[^\s<>"'()\[\]{}]+`)
+
+// A textParser finds the http(s) URLs in plain text, without the punctuation that often follows them in a sentence
+type textParser struct{}
+
+func (textParser) Parse(url string, body io.Reader) ([]Link, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	links := []Link{}
+	for _, u := range textURLPattern.FindAllString(string(b), -1) {
+		links = append(links, Link{URL: strings.TrimRight(u, ".,;:!?")})
+	}
+
+	return links, nil
+}
@@ -0,0 +1,49 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"syscall"
+)
+
+// Check that the seed URL can be crawled at all, so we can stop right away with a clear message instead of
+// producing an empty crawl. The error says why the seed cannot be crawled. The check stops when ctx is done.
+func checkSeed(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %v", url, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var dnsErr *net.DNSError
+		switch {
+		case errors.As(err, &dnsErr):
+			return fmt.Errorf("cannot resolve host %s: %v", dnsErr.Name, dnsErr.Err)
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return fmt.Errorf("connection refused by %s", url)
+		default:
+			return fmt.Errorf("cannot fetch %s: %v", url, err)
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned status %s", url, resp.Status)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+			return fmt.Errorf("%s is not an HTML page (Content-Type: %s)", url, ct)
+		}
+	}
+
+	return nil
+}
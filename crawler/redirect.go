@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// The URLs a request was redirected to before it got its final response, in order. The client keeps the
+// redirect response that led to a request in req.Response, so we can walk the chain back from the last one.
+func redirectChain(resp *http.Response) []string {
+	chain := []string{}
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		chain = append([]string{req.URL.String()}, chain...)
+	}
+
+	return chain
+}
+
+// The crawled URLs that went through more than max redirects, sorted by the length of their chain
+// (longest first) and then by URL
+func longRedirectChains(f fetcher, max int) []string {
+	urls := []string{}
+	for url, result := range f {
+		if len(result.redirects) > max {
+			urls = append(urls, url)
+		}
+	}
+
+	sort.Slice(urls, func(i, j int) bool {
+		if len(f[urls[i]].redirects) != len(f[urls[j]].redirects) {
+			return len(f[urls[i]].redirects) > len(f[urls[j]].redirects)
+		}
+		return urls[i] < urls[j]
+	})
+
+	return urls
+}
+
+// Print the URLs with more than max redirects, with every hop of their chain
+func printRedirectChains(f fetcher, max int) {
+	urls := longRedirectChains(f, max)
+
+	fmt.Fprintf(console, "\n=== Redirect chains longer than %d (%d)\n", max, len(urls))
+	for _, url := range urls {
+		fmt.Fprintf(console, "%v (%d redirects)\n", url, len(f[url].redirects))
+		for _, hop := range f[url].redirects {
+			fmt.Fprintf(console, "|-> %v\n", hop)
+		}
+	}
+}
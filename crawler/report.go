@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Group the crawled pages by their title, ignoring case and whitespace, and return the titles that are
+// shared by more than one page. The URLs of every title are sorted.
+func duplicateTitles(f fetcher) map[string][]string {
+	pages := map[string][]string{}
+	for url, result := range f {
+		title := titleKey(result.title)
+		if title != "" {
+			pages[title] = append(pages[title], url)
+		}
+	}
+
+	duplicates := map[string][]string{}
+	for title, urls := range pages {
+		if len(urls) > 1 {
+			sort.Strings(urls)
+			duplicates[title] = urls
+		}
+	}
+
+	return duplicates
+}
+
+// Print the titles that are used by more than one page, together with those pages
+func printDuplicateTitles(f fetcher) {
+	duplicates := duplicateTitles(f)
+
+	titles := []string{}
+	for title := range duplicates {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+
+	fmt.Fprintf(console, "\n=== Duplicate titles (%d)\n", len(titles))
+	for _, title := range titles {
+		fmt.Fprintf(console, "%v\n", title)
+		for _, url := range duplicates[title] {
+			fmt.Fprintf(console, "|-- %v\n", url)
+		}
+	}
+}
+
+// The frontier of a crawl: the URLs that were found but never fetched, because the crawl stopped at
+// the maximal depth, the maximal number of URLs or --max-per-level, or robots.txt disallowed them. The URLs that did
+// not get one of the max_urls slots stay in the history with their depth, so they are here too.
+// They are sorted by depth and then by URL.
+func frontier(f fetcher, depths map[string]int) []string {
+	urls := []string{}
+	for url := range depths {
+		if _, ok := f[url]; !ok {
+			urls = append(urls, url)
+		}
+	}
+
+	sort.Slice(urls, func(i, j int) bool {
+		if depths[urls[i]] != depths[urls[j]] {
+			return depths[urls[i]] < depths[urls[j]]
+		}
+		return urls[i] < urls[j]
+	})
+
+	return urls
+}
+
+// Print the URLs that were left to crawl when the crawl stopped
+func printFrontier(f fetcher, depths map[string]int) {
+	urls := frontier(f, depths)
+
+	fmt.Fprintf(console, "\n=== Frontier (%d URLs not crawled)\n", len(urls))
+	for _, url := range urls {
+		fmt.Fprintf(console, "%v (depth %d)\n", url, depths[url])
+	}
+}
+
+// The pages that link to themselves, with the links that point back to the page. Links are compared after
+// normalizeURL, and without their fragment and trailing slash, so /docs/ on /docs counts as well.
+func selfLinks(f fetcher) map[string][]string {
+	pages := map[string][]string{}
+	for url, result := range f {
+		for _, l := range result.links {
+			if samePage(url, l.url) {
+				pages[url] = append(pages[url], l.url)
+			}
+		}
+	}
+
+	return pages
+}
+
+// Whether two URLs are the same page when the fragment and a trailing slash are ignored
+func samePage(a, b string) bool {
+	strip := func(u string) string {
+		u = normalizeURL(u)
+		if i := strings.Index(u, "#"); i >= 0 {
+			u = u[:i]
+		}
+		return strings.TrimSuffix(u, "/")
+	}
+
+	return strip(a) == strip(b)
+}
+
+// Print the pages that link to themselves, with those links
+func printSelfLinks(f fetcher) {
+	pages := selfLinks(f)
+
+	urls := []string{}
+	for url := range pages {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	fmt.Fprintf(console, "\n=== Pages linking to themselves (%d)\n", len(urls))
+	for _, url := range urls {
+		fmt.Fprintf(console, "%v\n", url)
+		for _, l := range pages[url] {
+			fmt.Fprintf(console, "|-- %v\n", l)
+		}
+	}
+}
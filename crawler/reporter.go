@@ -0,0 +1,266 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// A Reporter is an output of the crawl. It gets every page as soon as it is crawled, and the statistics of the crawl
+// when it is finished. The crawler calls the reporters from one goroutine at a time, so they do not need to lock.
+// Add your own to Config.Reporters.
+type Reporter interface {
+	Page(url string, p Page)
+	Finish(s Stats)
+}
+
+// A pageReporter is a Reporter inside this package, which gets the whole result of every page, including the parts
+// that Page leaves out. The outputs of the command line are pageReporters. Finish gets the depth at which every URL
+// was found as well, which the file formats need, and returns why the output could not be written.
+type pageReporter interface {
+	Page(url string, r *result)
+	Finish(s Stats, depths map[string]int) error
+}
+
+// A Reporter of Config.Reporters, which gets every page as Crawler.Run returns it
+type exportedReporter struct {
+	Reporter
+}
+
+func (e exportedReporter) Page(url string, r *result) {
+	e.Reporter.Page(url, newPage(r))
+}
+
+func (e exportedReporter) Finish(s Stats, depths map[string]int) error {
+	e.Reporter.Finish(s)
+	return nil
+}
+
+// The reporters of this crawl, set up by Main or Crawler.Run before crawling
+var reporters []pageReporter
+
+// Install the reporters of the command line for the output options, which write the crawl to results or to the files
+// the options name. Without results, which Crawler.Run does not have without output-file, only the files are written.
+// It returns the statsCollector, which they all get the statistics from, and the graphReporter of --graph, or nil
+// without it. It fails when a file cannot be created.
+func installReporters(results io.Writer) (*statsCollector, *graphReporter, error) {
+	// the reporters get every page as soon as it is crawled, so they work with --stream-output too
+	stats := newStatsCollector()
+	reporters = append(reporters, stats)
+	switch *output {
+	case "urls":
+		if results != nil {
+			reporters = append(reporters, newURLReporter(results, *sortURLs))
+		}
+	case "sqlite":
+		sqlite, err := newSQLiteReporter(*dbPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		reporters = append(reporters, sqlite)
+	case "graphml":
+		reporters = append(reporters, newGraphReporter(*graphMLPath, "graphml"))
+	case "adjacency":
+		reporters = append(reporters, newAdjacencyReporter(*adjacencyPath))
+	default:
+		// the text output keeps the formatted pages until the crawl is finished, so it is left out with --stream-output
+		if results == nil {
+			break
+		}
+		if *format != "text" {
+			reporters = append(reporters, newExportReporter(results, *format))
+		} else if stream == nil {
+			list := listPages
+			if *summaryOnly {
+				list = listNone
+			} else if *groupByStatus {
+				list = listGrouped
+			}
+			reporters = append(reporters, newTextReporter(results, list))
+		}
+	}
+
+	// with --graph, the link graph is recorded while crawling, so it works with every output
+	var graph *graphReporter
+	if *graphPath != "" {
+		graph = newGraphReporter(*graphPath, *graphFormat)
+		reporters = append(reporters, graph)
+	}
+
+	return stats, graph, nil
+}
+
+// Send a page to every reporter. Only the holder of the resultsAccess token may call it.
+func reportPage(url string, r *result) {
+	for _, rep := range reporters {
+		rep.Page(url, r)
+	}
+}
+
+// Send the statistics and the depths of the finished crawl to every reporter. They are all finished, also when one
+// of them fails, and the first error is returned.
+func finishReporters(s Stats, depths map[string]int) error {
+	var err error
+	for _, rep := range reporters {
+		if ferr := rep.Finish(s, depths); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+
+	return err
+}
+
+// The ways the text output lists the crawled pages
+const (
+	listNone    = iota // only the statistics, with --summary-only
+	listPages          // every page with the links, media and headings found on it
+	listGrouped        // only the URLs, grouped by status class, with --group-by-status
+)
+
+// The buckets of the status classes, and the URLs we could not fetch at all
+var statusBuckets = []string{"2xx", "3xx", "4xx", "5xx", "errors"}
+
+// A textReporter writes the human readable output to w. The pages are formatted as they come in, but they are
+// only written when the crawl is finished, so they do not get mixed up with the progress dots.
+type textReporter struct {
+	w          io.Writer
+	list       int
+	startTitle *string
+	pages      bytes.Buffer
+	grouped    map[string][]string
+}
+
+func newTextReporter(w io.Writer, list int) *textReporter {
+	return &textReporter{w: w, list: list, grouped: map[string][]string{}}
+}
+
+func (t *textReporter) Page(url string, r *result) {
+	if url == normalizeURL(*startURL) {
+		t.startTitle = &r.title
+	}
+
+	switch t.list {
+	case listPages:
+		t.writePage(url, r)
+	case listGrouped:
+		bucket := "errors"
+		if r.status >= 200 && r.status < 600 && r.err == nil {
+			bucket = fmt.Sprintf("%dxx", r.status/100)
+		}
+		if r.err != nil {
+			t.grouped[bucket] = append(t.grouped[bucket], fmt.Sprintf("%v (%v)", url, r.err))
+		} else {
+			t.grouped[bucket] = append(t.grouped[bucket], fmt.Sprintf("%v (%d)", url, r.status))
+		}
+	}
+}
+
+// Write the page with its title and the URLs found on it
+func (t *textReporter) writePage(url string, r *result) {
+	w := &t.pages
+
+	if r.old {
+		fmt.Fprintf(w, "%v (not modified since %s)\n", url, *sinceDate)
+		return
+	}
+
+	if r.truncated {
+		fmt.Fprintf(w, "%v (%v) (truncated: %v)\n", url, r.title, r.err)
+	} else if r.err != nil {
+		fmt.Fprintf(w, "%v (%v) (error: %v)\n", url, r.title, r.err)
+	} else if r.status >= 400 {
+		fmt.Fprintf(w, "%v (%v) (status: %d %s)\n", url, r.title, r.status, http.StatusText(r.status))
+	} else if r.unparsed {
+		fmt.Fprintf(w, "%v (not parsed: %s)\n", url, r.contentType)
+	} else if r.capped {
+		fmt.Fprintf(w, "%v (%v) (pagination capped)\n", url, r.title)
+	} else {
+		fmt.Fprintf(w, "%v (%v)\n", url, r.title)
+	}
+	for _, l := range r.links {
+		fmt.Fprintf(w, "|-- %v", l.url)
+		if l.rel != "" {
+			fmt.Fprintf(w, " (rel=%v)", l.rel)
+		}
+		fmt.Fprintln(w)
+	}
+	for _, m := range r.media {
+		fmt.Fprintf(w, "|-- [media] %v\n", m)
+	}
+	for _, i := range r.images {
+		if i.descriptor != "" {
+			fmt.Fprintf(w, "|-- [image] %v (%v)\n", i.url, i.descriptor)
+		} else {
+			fmt.Fprintf(w, "|-- [image] %v\n", i.url)
+		}
+	}
+	for _, h := range r.headings {
+		fmt.Fprintf(w, "|-- [h%d] %s%v\n", h.level, strings.Repeat("  ", h.level-1), h.text)
+	}
+	if r.description != "" {
+		fmt.Fprintf(w, "|-- [description] %v\n", r.description)
+	}
+	if r.canonical != "" {
+		fmt.Fprintf(w, "|-- [canonical] %v\n", r.canonical)
+	}
+	for _, a := range r.assets {
+		fmt.Fprintf(w, "|-- [asset] %v\n", a)
+	}
+}
+
+func (t *textReporter) Finish(s Stats, depths map[string]int) error {
+	switch t.list {
+	case listPages:
+		fmt.Fprint(t.w, "Start URL:", *startURL)
+		if t.startTitle != nil {
+			fmt.Fprintf(t.w, "(%s)", *t.startTitle)
+		}
+		fmt.Fprintln(t.w)
+		t.w.Write(t.pages.Bytes())
+	case listGrouped:
+		for _, bucket := range statusBuckets {
+			lines := t.grouped[bucket]
+			sort.Strings(lines)
+
+			fmt.Fprintf(t.w, "\n=== %s (%d)\n", bucket, len(lines))
+			for _, line := range lines {
+				fmt.Fprintln(t.w, line)
+			}
+		}
+	}
+
+	s.print(t.w)
+	return nil
+}
+
+// A urlReporter writes the URLs of the pages that were crawled without an error to w, one per line and nothing else,
+// for --output=urls. Like the text output, they are written when the crawl is finished.
+type urlReporter struct {
+	w      io.Writer
+	sorted bool
+	urls   []string
+}
+
+func newURLReporter(w io.Writer, sorted bool) *urlReporter {
+	return &urlReporter{w: w, sorted: sorted}
+}
+
+func (u *urlReporter) Page(url string, r *result) {
+	if r.err == nil && r.status < 400 {
+		u.urls = append(u.urls, url)
+	}
+}
+
+func (u *urlReporter) Finish(s Stats, depths map[string]int) error {
+	if u.sorted {
+		sort.Strings(u.urls)
+	}
+	for _, url := range u.urls {
+		fmt.Fprintln(u.w, url)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// How long to wait before fetching a page again. The wait doubles with every retry.
+const retryBackoff = 500 * time.Millisecond
+
+// A retryError is returned by fetch when fetching the page failed in a way that may not happen again:
+// the request timed out, the connection was reset, the server answered with a 5xx status, or the connection broke
+// while the page was read
+type retryError struct {
+	err error
+}
+
+func (e *retryError) Error() string {
+	return "retrying: " + e.err.Error()
+}
+
+func (e *retryError) Unwrap() error {
+	return e.err
+}
+
+// A fetcher implements fetching, which performs the crawling for an input URL and returns the URLs found in the body.
+// When fetching the page fails with a retryError, it is fetched again up to --retries times, with a short wait in
+// between. If it still fails the last time, the page is recorded like any other failed page. A page that broke off
+// is recorded as truncated, with the links found before it broke, and none of them are followed.
+func (f fetcher) Fetch(url string) ([]string, error) {
+	return f.FetchContext(context.Background(), url)
+}
+
+// FetchContext is Fetch for a crawl with the context ctx. When ctx is done, the request is stopped, and the page is
+// not recorded, so a resumed crawl fetches it.
+func (f fetcher) FetchContext(ctx context.Context, url string) ([]string, error) {
+	wait := retryBackoff
+	for attempt := 0; ; attempt++ {
+		urls, err := f.fetch(ctx, url, attempt < *retries)
+
+		var r *retryError
+		if !errors.As(err, &r) {
+			return urls, err
+		}
+
+		// an aborted crawl does not wait for another attempt, the page is left for a resumed crawl
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, r.err
+		}
+		wait *= 2
+	}
+}
+
+// Whether the request failed in a way that may not happen again: it took longer than --timeout, or the server
+// closed or reset the connection before it answered
+func isTransient(err error) bool {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,290 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The parsed robots.txt of a host: the rules and the Crawl-delay that apply to our --user_agent,
+// and the sitemaps it lists
+type robotsTxt struct {
+	rules    []robotsRule
+	delay    time.Duration
+	sitemaps []string
+}
+
+// An Allow or Disallow line of a robots.txt. The path may contain * for any characters and end with $ to match
+// the end of the URL, see https://www.rfc-editor.org/rfc/rfc9309
+type robotsRule struct {
+	allow   bool
+	path    string
+	pattern *regexp.Regexp
+}
+
+// The robots.txt of every host we crawled, by the URL of the robots.txt, which is only fetched once.
+// A host that is being fetched has its entry already, so the others wait for it instead of fetching it too.
+var robotsCache = struct {
+	sync.Mutex
+	hosts map[string]*hostRobots
+}{hosts: map[string]*hostRobots{}}
+
+// The robots.txt of a host, and when the next page of the host may be fetched because of its Crawl-delay
+type hostRobots struct {
+	once   sync.Once
+	robots *robotsTxt
+	err    error
+
+	sync.Mutex
+	next time.Time
+}
+
+// The number of URLs that were not crawled because robots.txt disallowed them
+var robotsDisallowed atomic.Int64
+
+// Whether we follow the rules of robots.txt, which is the default
+func robotsRespected() bool {
+	return *respectRobots && !*ignoreRobots
+}
+
+// Whether robots.txt allows us to crawl u. When the robots.txt of the host is missing or cannot be read,
+// everything is allowed, so we do not silently stop crawling sites that do not have one.
+func robotsAllowed(u string) bool {
+	if !robotsRespected() {
+		return true
+	}
+
+	robots, err := robotsFor(u)
+	if err != nil {
+		return true
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return true
+	}
+
+	return robots.allowed(parsed.RequestURI())
+}
+
+// The sitemaps listed by the Sitemap: lines in the robots.txt of the host of u. A host without a robots.txt
+// has no sitemaps, which is not an error.
+func robotsSitemaps(u string) ([]string, error) {
+	robots, err := robotsFor(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return robots.sitemaps, nil
+}
+
+// Wait until the Crawl-delay of the host of u has passed since the previous page of the host we fetched,
+// and take the next turn of the host. Hosts without a Crawl-delay do not wait, and neither does an aborted crawl.
+func waitCrawlDelay(u string) {
+	if !robotsRespected() {
+		return
+	}
+
+	h, err := robotsHost(u)
+	if err != nil || h.err != nil || h.robots.delay == 0 {
+		return
+	}
+
+	h.Lock()
+	turn := h.next
+	if now := time.Now(); turn.Before(now) {
+		turn = now
+	}
+	h.next = turn.Add(h.robots.delay)
+	h.Unlock()
+
+	sleepUnlessAborted(time.Until(turn))
+}
+
+// The robots.txt of the host of u, from the cache or else fetched now
+func robotsFor(u string) (*robotsTxt, error) {
+	h, err := robotsHost(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.robots, h.err
+}
+
+// The cache entry of the host of u, with its robots.txt fetched
+func robotsHost(u string) (*hostRobots, error) {
+	robots, err := robotsURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	robotsCache.Lock()
+	h := robotsCache.hosts[robots]
+	if h == nil {
+		h = &hostRobots{}
+		robotsCache.hosts[robots] = h
+	}
+	robotsCache.Unlock()
+
+	h.once.Do(func() {
+		h.robots, h.err = fetchRobots(robots)
+	})
+
+	return h, nil
+}
+
+// The URL of the robots.txt of the host of u, which only http and https URLs have
+func robotsURL(u string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("%s has no robots.txt", u)
+	}
+
+	return parsed.Scheme + "://" + strings.ToLower(parsed.Host) + "/robots.txt", nil
+}
+
+// Fetch and parse the robots.txt at the URL. A robots.txt that does not exist allows everything,
+// like an empty one does.
+func fetchRobots(robots string) (*robotsTxt, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	req, err := newRequest(ctx, robots)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode <= 499 {
+		return &robotsTxt{}, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s returned status %s", robots, resp.Status)
+	}
+
+	// like Google, we only read the first 500 KB of a robots.txt
+	return parseRobots(robots, io.LimitReader(resp.Body, 500<<10), *userAgent)
+}
+
+// Parse a robots.txt, keeping the rules and Crawl-delay of the groups for the agent. A group is one or more User-agent
+// lines followed by its rules. When no group names the agent, the rules of the * groups apply. Sitemap: lines do not
+// belong to a group, so they can be anywhere in the file, and relative ones are resolved against the robots.txt.
+func parseRobots(robots string, r io.Reader, agent string) (*robotsTxt, error) {
+	// the product token of the agent, e.g. gocrawler for gocrawler/1.0, which the User-agent lines are matched with
+	token := strings.ToLower(strings.TrimSpace(agent))
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	result := &robotsTxt{}
+	var matching, wildcard []robotsRule
+	var matchingDelay, wildcardDelay time.Duration
+	named := false
+
+	// the agents of the group we are in, and whether we already read a rule of it
+	agents := []string{}
+	inRules := false
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// a User-agent line after the rules starts the next group
+			if inRules {
+				agents = []string{}
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			rule := newRobotsRule(key == "allow", value)
+			for _, a := range agents {
+				if a == "*" {
+					wildcard = append(wildcard, rule)
+				} else if a != "" && strings.Contains(token, a) {
+					matching = append(matching, rule)
+					named = true
+				}
+			}
+		case "crawl-delay":
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds <= 0 {
+				continue
+			}
+			for _, a := range agents {
+				if a == "*" {
+					wildcardDelay = time.Duration(seconds * float64(time.Second))
+				} else if a != "" && strings.Contains(token, a) {
+					matchingDelay = time.Duration(seconds * float64(time.Second))
+					named = true
+				}
+			}
+		case "sitemap":
+			if u, ok := resolve(robots, value); ok && value != "" {
+				result.sitemaps = append(result.sitemaps, u)
+			}
+		}
+	}
+
+	result.rules, result.delay = wildcard, wildcardDelay
+	if named {
+		result.rules, result.delay = matching, matchingDelay
+	}
+
+	return result, s.Err()
+}
+
+// Create the rule for an Allow or Disallow line with the path
+func newRobotsRule(allow bool, path string) robotsRule {
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(path), `\*`, ".*")
+	if strings.HasSuffix(path, "$") {
+		expr = strings.TrimSuffix(expr, `\$`) + "$"
+	}
+
+	return robotsRule{allow, path, regexp.MustCompile(expr)}
+}
+
+// Whether the rules allow the path (with its query). The longest rule that matches wins, and Allow wins when
+// an Allow and a Disallow rule are equally long. An empty Disallow allows everything.
+func (r *robotsTxt) allowed(path string) bool {
+	best, allow := -1, true
+
+	for _, rule := range r.rules {
+		if rule.path == "" || !rule.pattern.MatchString(path) {
+			continue
+		}
+		if len(rule.path) > best || (len(rule.path) == best && rule.allow) {
+			best, allow = len(rule.path), rule.allow
+		}
+	}
+
+	return allow
+}
@@ -0,0 +1,139 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// The host of the start URL, as given by siteHost, and its registrable domain, as given by siteDomain. Set by setup.
+var startHost, startDomain string
+
+// The compiled --allow and --deny patterns, nil when they are not used. Set by setup.
+var allowPattern, denyPattern *regexp.Regexp
+
+// How many links every scope rule skipped, by the name of its option
+var scopeSkipped = struct {
+	sync.Mutex
+	counts map[string]int
+}{counts: map[string]int{}}
+
+// Whether a URL is in the scope of the crawl, by the rules that only depend on the URL itself.
+// See scopeRule for the rules.
+func inScope(u string) bool {
+	return scopeRule(u) == ""
+}
+
+// Like inScope, but count the URL for the summary when a rule skips it. Use it for the links found on pages,
+// so every link is counted once.
+func linkInScope(u string) bool {
+	rule := scopeRule(u)
+	if rule == "" {
+		return true
+	}
+
+	scopeSkipped.Lock()
+	scopeSkipped.counts[rule]++
+	scopeSkipped.Unlock()
+
+	return false
+}
+
+// The option that puts a URL out of the scope of the crawl, or "" when it is in scope. URLs outside of the scope are
+// never crawled, however we found them:
+//
+//	--same_host           URLs on other hosts than the start URL, or with --include-subdomains, not under it either
+//	--same-domain         URLs outside of the registrable domain of the start URL, e.g. example.co.uk
+//	--allow, --deny       URLs that do not match --allow, or that match --deny
+//	--max-path-depth      deeply nested URLs
+//
+// The rules that depend on the page a link is on, like --same-directory, are applied when the page is read.
+func scopeRule(u string) string {
+	switch {
+	case *sameHost && !sameHostAs(u):
+		return "--same_host"
+	case *sameDomain && siteDomain(u) != startDomain:
+		return "--same-domain"
+	case allowPattern != nil && !allowPattern.MatchString(u):
+		return "--allow"
+	case denyPattern != nil && denyPattern.MatchString(u):
+		return "--deny"
+	case *maxPathDepth > 0 && pathDepth(u) > *maxPathDepth:
+		return "--max-path-depth"
+	}
+
+	return ""
+}
+
+// Whether u is on the host of the start URL, or with --include-subdomains on a host under it
+func sameHostAs(u string) bool {
+	host := siteHost(u)
+	return host == startHost || (*includeSubdomains && strings.HasSuffix(host, "."+startHost))
+}
+
+// The host of a URL, with its port, as --same_host compares it. www.example.com is the same site as example.com,
+// so the www. is left out, but other subdomains like blog.example.com are different hosts.
+func siteHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
+}
+
+// The registrable domain of a URL, like example.com for blog.example.com and example.co.uk for www.example.co.uk.
+// Hosts that do not have one, like localhost and IP addresses, are their own domain.
+func siteDomain(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+
+	return host
+}
+
+// Compile the --allow and --deny patterns
+func parseScopePatterns() error {
+	var err error
+
+	allowPattern, denyPattern = nil, nil
+	if *allowFlag != "" {
+		if allowPattern, err = regexp.Compile(*allowFlag); err != nil {
+			return fmt.Errorf("Invalid --allow: %v", err)
+		}
+	}
+	if *denyFlag != "" {
+		if denyPattern, err = regexp.Compile(*denyFlag); err != nil {
+			return fmt.Errorf("Invalid --deny: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// The number of links every scope rule skipped, as "12 by --same-domain, 3 by --deny", or "" when none were
+func scopeSkippedSummary(counts map[string]int) string {
+	rules := []string{}
+	for rule := range counts {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+
+	parts := []string{}
+	for _, rule := range rules {
+		parts = append(parts, fmt.Sprintf("%d by %s", counts[rule], rule))
+	}
+
+	return strings.Join(parts, ", ")
+}
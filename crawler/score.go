@@ -0,0 +1,45 @@
+package crawler
+
+import "sort"
+
+// A Score decides which URLs are crawled first: the URLs at one depth get the max_urls slots that are left from the
+// highest score to the lowest, and are started in that order. Referrer is the page the URL was first found on, which
+// is empty for the start URL and for URLs of a resumed crawl. Set Config.Score to steer the crawl, e.g. to crawl the
+// product pages of a shop before the others:
+//
+//	Score: func(url string, depth int, referrer string) float64 {
+//	    if strings.Contains(url, "product") {
+//	        return 1
+//	    }
+//	    return 0
+//	}
+type Score func(url string, depth int, referrer string) float64
+
+// The default Score is by inverse depth. Since the crawl is breadth first, shallower URLs are always crawled first
+// anyway, so the URLs of one depth are crawled in the order of their URL.
+func inverseDepth(url string, depth int, referrer string) float64 {
+	return 1 / float64(depth+1)
+}
+
+// The Score of this crawl, set by Crawler.Run
+var score Score = inverseDepth
+
+// Sort the URLs found at the given depth from the highest score to the lowest, and by URL when they score the same.
+// Their referrers are dropped once they are scored.
+func prioritize(level []frontierURL, depth int) []string {
+	urls := make([]string, len(level))
+	scores := map[string]float64{}
+	for i, u := range level {
+		urls[i] = u.url
+		scores[u.url] = score(u.url, depth, u.referrer)
+	}
+
+	sort.Slice(urls, func(i, j int) bool {
+		if scores[urls[i]] != scores[urls[j]] {
+			return scores[urls[i]] > scores[urls[j]]
+		}
+		return urls[i] < urls[j]
+	})
+
+	return urls
+}
@@ -0,0 +1,75 @@
+package crawler
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A seenLog is the file of --seen-db: every URL crawled by earlier runs, one per line. URLs in it are skipped, and
+// the URLs this run crawls are appended to it, so a crawler that runs every day only reports every URL once.
+// URLs are only added once they were fetched, so the ones that failed or were never crawled are tried again next time.
+type seenLog struct {
+	sync.Mutex
+	seen map[string]bool
+	file *os.File
+	w    *bufio.Writer
+}
+
+// The log of --seen-db, nil when every run starts from scratch
+var seenURLs *seenLog
+
+// Open the log at path, creating it when it does not exist yet, and read the URLs in it
+func openSeenLog(path string) (*seenLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &seenLog{seen: map[string]bool{}, file: file, w: bufio.NewWriter(file)}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if u := strings.TrimSpace(scanner.Text()); u != "" {
+			s.seen[u] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Whether an earlier run, or this one, crawled the URL
+func (s *seenLog) Seen(url string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.seen[url]
+}
+
+// Add a URL crawled by this run to the log
+func (s *seenLog) Add(url string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.seen[url] {
+		return
+	}
+
+	s.seen[url] = true
+	s.w.WriteString(url + "\n")
+}
+
+// Write the new URLs to the file and close it
+func (s *seenLog) Close() error {
+	err := s.w.Flush()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
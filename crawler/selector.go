@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A selector matches an element by tag, id and class, like the CSS selectors main, div#content, div.post or #content
+type selector struct {
+	tag   string
+	id    string
+	class string
+}
+
+// The selector from --content-selector, nil when links are taken from the whole page
+var contentSelector *selector
+
+// Elements that never have an end tag, so they do not change how deep we are in the document
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true, "input": true,
+	"link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// Parse a selector of the form tag, tag#id, tag.class, #id or .class
+func parseSelector(s string) *selector {
+	sel := &selector{}
+
+	if i := strings.IndexAny(s, "#."); i >= 0 {
+		if s[i] == '#' {
+			sel.id = s[i+1:]
+		} else {
+			sel.class = s[i+1:]
+		}
+		s = s[:i]
+	}
+	sel.tag = strings.ToLower(s)
+
+	return sel
+}
+
+// Whether the start tag token matches the selector
+func (s *selector) matches(t html.Token) bool {
+	if s.tag != "" && t.Data != s.tag {
+		return false
+	}
+
+	for _, a := range t.Attr {
+		switch a.Key {
+		case "id":
+			if s.id != "" && a.Val == s.id {
+				return true
+			}
+		case "class":
+			for _, c := range strings.Fields(a.Val) {
+				if s.class != "" && c == s.class {
+					return true
+				}
+			}
+		}
+	}
+
+	return s.id == "" && s.class == ""
+}
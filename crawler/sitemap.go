@@ -0,0 +1,241 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// How deep sitemap indexes may refer to other sitemap indexes. The protocol does not allow nesting at all,
+// but some sites do it anyway, and this keeps a loop of indexes from going on forever.
+const maxSitemapNesting = 3
+
+// A sitemap is either a urlset with the pages of a site, or a sitemapindex with the URLs of other sitemaps,
+// see https://www.sitemaps.org/protocol.html. RSS and Atom feeds are read the same way, the links of their items
+// are the pages.
+type sitemapXML struct {
+	XMLName  xml.Name
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+
+	// the <link>URL</link> of every item of an RSS feed, and the <link href="URL"/> of every entry of an Atom feed
+	Items   []string `xml:"channel>item>link"`
+	Entries []struct {
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// The pages in a sitemap or feed. An Atom entry may have several links, the page is the one without a rel
+// or with rel="alternate".
+func (s *sitemapXML) pages() []string {
+	pages := append(s.URLs, s.Items...)
+	for _, e := range s.Entries {
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				pages = append(pages, l.Href)
+				break
+			}
+		}
+	}
+
+	return pages
+}
+
+// The page URLs in the sitemaps (or feeds) at the given URLs, following sitemap indexes. A sitemap that cannot be read
+// is skipped with a warning, so one broken sitemap does not lose the pages of the others.
+func sitemapPages(sitemaps []string) []string {
+	pages := []string{}
+	seen := map[string]bool{}
+
+	var read func(sitemaps []string, nesting int)
+	read = func(sitemaps []string, nesting int) {
+		for _, u := range sitemaps {
+			if seen[u] {
+				continue
+			}
+			seen[u] = true
+
+			s, err := fetchSitemap(u)
+			if err != nil {
+				fmt.Fprintf(console, "=== Cannot read sitemap %s: %v\n", u, err)
+				continue
+			}
+
+			for _, p := range s.pages() {
+				if p = strings.TrimSpace(p); p != "" {
+					pages = append(pages, p)
+				}
+			}
+
+			if len(s.Sitemaps) > 0 {
+				if nesting >= maxSitemapNesting {
+					fmt.Fprintf(console, "=== Not following the sitemap index %s, it is nested too deep\n", u)
+					continue
+				}
+				nested := []string{}
+				for _, n := range s.Sitemaps {
+					if n = strings.TrimSpace(n); n != "" {
+						nested = append(nested, n)
+					}
+				}
+				read(nested, nesting+1)
+			}
+		}
+	}
+	read(sitemaps, 0)
+
+	return pages
+}
+
+// Fetch and parse the sitemap or feed at u, which may be gzipped, as sitemap.xml.gz often is
+func fetchSitemap(u string) (*sitemapXML, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	req, err := newRequest(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+
+	body := bufio.NewReader(io.LimitReader(resp.Body, *maxBodySize))
+
+	// look at the content instead of the name or the Content-Type, which are often wrong for gzipped sitemaps
+	var r io.Reader = body
+	if magic, _ := body.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = io.LimitReader(gz, *maxBodySize)
+	}
+
+	s := &sitemapXML{}
+	if err := xml.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	switch s.XMLName.Local {
+	case "urlset", "sitemapindex", "rss", "feed":
+	default:
+		return nil, fmt.Errorf("not a sitemap or feed: <%s>", s.XMLName.Local)
+	}
+
+	return s, nil
+}
+
+// The pages to add to the frontier from the sitemaps and feeds of the start URL, which all get depth 1, as if the
+// start URL linked to them: the pages in the sitemaps given with --sitemap, in the ones listed in its robots.txt with
+// --robots-sitemaps, and with --use-sitemap in those or else /sitemap.xml, and in the RSS and Atom feeds the start page
+// links to. Without these options there are none.
+func discoverSeeds(start string) []string {
+	sitemaps := []string{}
+	for _, s := range strings.Split(*sitemapFlag, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			sitemaps = append(sitemaps, s)
+		}
+	}
+
+	if *robotsSitemapsFlag || *useSitemap {
+		found, err := robotsSitemaps(start)
+		if err != nil {
+			fmt.Fprintln(console, "=== Cannot read robots.txt:", err)
+		}
+		if len(found) == 0 && *useSitemap {
+			if u, err := url.Parse(start); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				found = []string{u.Scheme + "://" + u.Host + "/sitemap.xml"}
+			}
+		}
+		sitemaps = append(sitemaps, found...)
+	}
+
+	feeds := []string{}
+	if *useSitemap {
+		feeds = feedLinks(start)
+	}
+	if len(sitemaps) == 0 && len(feeds) == 0 {
+		return nil
+	}
+
+	pages := sitemapPages(append(sitemaps, feeds...))
+	fmt.Fprintf(console, "=== Sitemaps: %d, feeds: %d, pages: %d\n", len(sitemaps), len(feeds), len(pages))
+	return pages
+}
+
+// The URLs of the RSS and Atom feeds the page at u links to with <link rel="alternate">, like browsers find them
+func feedLinks(u string) []string {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	req, err := newRequest(ctx, u)
+	if err != nil {
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	_, body, err := decodeBody(resp)
+	if err != nil {
+		return nil
+	}
+
+	feeds := []string{}
+	z := html.NewTokenizer(io.LimitReader(body, *maxBodySize))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return feeds
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.Data != "link" {
+				continue
+			}
+
+			rel, typ, href := "", "", ""
+			for _, a := range t.Attr {
+				switch a.Key {
+				case "rel":
+					rel = strings.ToLower(a.Val)
+				case "type":
+					typ = strings.ToLower(strings.TrimSpace(a.Val))
+				case "href":
+					href = a.Val
+				}
+			}
+
+			if !slices.Contains(strings.Fields(rel), "alternate") {
+				continue
+			}
+			if typ != "application/rss+xml" && typ != "application/atom+xml" {
+				continue
+			}
+			if feed, ok := resolve(resp.Request.URL.String(), href); ok {
+				feeds = append(feeds, feed)
+			}
+		}
+	}
+}
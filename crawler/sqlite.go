@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"database/sql"
+
+	// pure Go SQLite driver, so no cgo is needed
+	_ "modernc.org/sqlite"
+)
+
+// The tables that store a crawl. Every crawled page is a row in pages, and every URL found on a page is a row in links.
+// The tables are recreated on every run, so the database always reflects the latest crawl.
+var sqliteSchema = []string{
+	`DROP TABLE IF EXISTS pages`,
+	`DROP TABLE IF EXISTS links`,
+	`CREATE TABLE pages (url TEXT PRIMARY KEY, title TEXT, depth INTEGER, status INTEGER)`,
+	`CREATE TABLE links ("from" TEXT, "to" TEXT, rel TEXT, type TEXT)`,
+}
+
+// A sqliteReporter writes the crawled pages and their links to a SQLite database as they come in, for --output=sqlite.
+// All rows are inserted in a single transaction, since inserting them one by one is very slow in SQLite, which is
+// committed when the crawl is finished. The depths are only known then, so they are filled in last.
+type sqliteReporter struct {
+	db    *sql.DB
+	tx    *sql.Tx
+	pages *sql.Stmt
+	links *sql.Stmt
+	err   error
+}
+
+// Create the tables in the SQLite database at path, and start the transaction that the pages are inserted in
+func newSQLiteReporter(path string) (*sqliteReporter, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqliteReporter{db: db}
+	if err := s.begin(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *sqliteReporter) begin() error {
+	for _, stmt := range sqliteSchema {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if s.tx, err = s.db.Begin(); err != nil {
+		return err
+	}
+	if s.pages, err = s.tx.Prepare(`INSERT INTO pages (url, title, depth, status) VALUES (?, ?, 0, ?)`); err != nil {
+		return err
+	}
+	s.links, err = s.tx.Prepare(`INSERT INTO links ("from", "to", rel, type) VALUES (?, ?, ?, ?)`)
+	return err
+}
+
+// Insert the page and its links. The first error is kept for Finish, and nothing is inserted after it.
+func (s *sqliteReporter) Page(url string, r *result) {
+	if s.err != nil {
+		return
+	}
+
+	if _, s.err = s.pages.Exec(url, r.title, r.status); s.err != nil {
+		return
+	}
+	for _, l := range r.links {
+		if _, s.err = s.links.Exec(url, l.url, l.rel, l.typ); s.err != nil {
+			return
+		}
+	}
+}
+
+// Fill in the depths of the pages and commit them, or roll them back after an error
+func (s *sqliteReporter) Finish(_ Stats, depths map[string]int) error {
+	defer s.db.Close()
+
+	// Rollback is a no-op after a successful Commit
+	defer s.tx.Rollback()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	depth, err := s.tx.Prepare(`UPDATE pages SET depth = ? WHERE url = ?`)
+	if err != nil {
+		return err
+	}
+	defer depth.Close()
+
+	for url, d := range depths {
+		if _, err := depth.Exec(d, url); err != nil {
+			return err
+		}
+	}
+
+	return s.tx.Commit()
+}
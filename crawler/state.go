@@ -0,0 +1,217 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The state of a crawl that is saved with --state or --state-dir, so the crawl can be resumed after it was interrupted.
+// Every crawl has its own directory, which is the --state directory, or the one named after its --crawl-id
+// in --state-dir, with these files:
+//
+//	visited.json   every URL seen so far, mapped to the depth at which it was found
+//	frontier.json  the URLs that were found but not crawled yet, mapped to their depth, which are crawled on resume
+//	results.json   the pages crawled so far
+//
+// The files are replaced every --state-interval and when the crawl finishes. When the process is killed,
+// only the pages crawled since the last save are fetched again.
+type crawlState struct {
+	dir   string
+	depth int
+}
+
+// The directory of the state of the crawl, from --state or --state-dir and --crawl-id. Empty when it is not saved.
+// Set by setup.
+var crawlStateDir string
+
+// Crawl from the seeds like Crawl does, but save the state of the crawl in dir while crawling. If dir has the state
+// of an earlier run, that crawl is resumed instead: the pages it crawled are loaded into f and not fetched again.
+func crawlWithState(ctx context.Context, dir string, seeds []string, depth int, f fetcher) (map[string]int, error) {
+	s := &crawlState{dir, depth}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	visited, remaining, err := s.load(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// when there is no earlier run, start a new crawl from the seeds
+	frontier := map[string]int{}
+	if len(visited) == 0 {
+		frontier = seedFrontier(visited, seeds)
+	} else {
+		// the scope may have been narrowed since the crawl was interrupted, so drop the URLs that are outside of it now.
+		// They stay in the visited set, so they are not found again, and in the saved frontier for a wider crawl later
+		dropped := 0
+		for u, d := range remaining {
+			// the results are saved before the frontier, so a page may have been crawled since the frontier was saved
+			if _, ok := f[u]; ok {
+				continue
+			}
+			if inScope(u) {
+				frontier[u] = d
+			} else {
+				dropped++
+			}
+		}
+		if dropped > 0 {
+			fmt.Fprintf(console, "=== Dropped %d URLs outside of the scope from the frontier\n", dropped)
+		}
+	}
+
+	c := newCrawlHistory(f, visited, depth)
+
+	stop := make(chan bool)
+	saved := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(*stateInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// a failed save is retried at the next tick, the final save reports the error
+				s.save(c.snapshot(), f)
+			case <-stop:
+				saved <- s.save(c.snapshot(), f)
+				return
+			}
+		}
+	}()
+
+	c.crawlFrontier(ctx, frontier)
+
+	close(stop)
+	if err := <-saved; err != nil {
+		return nil, err
+	}
+
+	return c.depths(), nil
+}
+
+// A copy of the URLs seen so far, which can be saved while the crawl goes on
+func (c *crawlHistory) snapshot() exactSet {
+	m := <-c.mapAccess
+	defer func() { c.mapAccess <- m }()
+
+	visited := exactSet{}
+	if depths, ok := m.(exactSet); ok {
+		for u, d := range depths {
+			visited[u] = d
+		}
+	}
+
+	return visited
+}
+
+// The URLs that were found but not crawled yet, with their depth. URLs at the maximal depth are never crawled,
+// so they are left out. Call it with the access to the results.
+func (s *crawlState) frontier(visited exactSet, f fetcher) map[string]int {
+	urls := map[string]int{}
+	for u, d := range visited {
+		if _, ok := f[u]; !ok && d < s.depth {
+			urls[u] = d
+		}
+	}
+
+	return urls
+}
+
+// Load the state saved in the directory: the pages are stored in f, and the URLs seen and the frontier are returned.
+// When nothing was saved yet, the visited set is empty.
+func (s *crawlState) load(f fetcher) (exactSet, map[string]int, error) {
+	visited := exactSet{}
+	if err := readJSON(filepath.Join(s.dir, "visited.json"), &visited); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return exactSet{}, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	pages := []jsonPage{}
+	if err := readJSON(filepath.Join(s.dir, "results.json"), &pages); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	frontier := map[string]int{}
+	if err := readJSON(filepath.Join(s.dir, "frontier.json"), &frontier); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+
+	// the URLs found before count for the statistics of the resumed crawl, like its pages do
+	uniqueURLs.Add(int64(len(visited)))
+
+	for _, p := range pages {
+		r := p.result()
+		f[p.URL] = r
+		reportPage(p.URL, r)
+
+		// the pages crawled before took their max_urls slots
+		countCrawled.Add(1)
+	}
+
+	return visited, frontier, nil
+}
+
+// Whether dir has the state of an earlier crawl
+func stateSaved(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "visited.json"))
+	return err == nil
+}
+
+// Save the URLs seen so far, the pages crawled so far and the frontier
+func (s *crawlState) save(visited exactSet, f fetcher) error {
+	resultsAccess <- true
+	pages := []jsonPage{}
+	for url, r := range f {
+		pages = append(pages, newJSONPage(url, r))
+	}
+	// the frontier is taken from the same pages, so every URL is either in the results or in the frontier
+	frontier := s.frontier(visited, f)
+	<-resultsAccess
+
+	sort.Slice(pages, func(i, j int) bool { return pages[i].URL < pages[j].URL })
+
+	if err := writeJSON(filepath.Join(s.dir, "results.json"), pages); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(s.dir, "frontier.json"), frontier); err != nil {
+		return err
+	}
+
+	// the visited set is written last, since a crawl is only resumed when it exists
+	return writeJSON(filepath.Join(s.dir, "visited.json"), visited)
+}
+
+// Read the JSON file at path into v
+func readJSON(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
+
+// Write v as JSON to the file at path. The file is replaced at once, so it is never left half written.
+func writeJSON(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,209 @@
+package crawler
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// The ID of this crawl, which is written with every page so the pages of different runs can be told apart
+// when they are appended to the same file. Every crawl gets a new one from reset.
+var runID = newRunID()
+
+// Create a random ID for a crawl
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// The JSON form of a crawled page, as it is written with --stream-output
+type jsonPage struct {
+	Run          string            `json:"run"`
+	Time         time.Time         `json:"time"`
+	URL          string            `json:"url"`
+	Title        string            `json:"title"`
+	Status       int               `json:"status"`
+	Links        []jsonLink        `json:"links"`
+	Media        []string          `json:"media,omitempty"`
+	Headings     []jsonHeading     `json:"headings,omitempty"`
+	Old          bool              `json:"old,omitempty"`
+	Capped       bool              `json:"capped,omitempty"`
+	Truncated    bool              `json:"truncated,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	TLSError     string            `json:"tls_error,omitempty"`
+	Redirects    []string          `json:"redirects,omitempty"`
+	Size         int64             `json:"size"`
+	Transferred  int64             `json:"transferred"`
+	OpenGraph    map[string]string `json:"open_graph,omitempty"`
+	Twitter      map[string]string `json:"twitter,omitempty"`
+	MixedContent []string          `json:"mixed_content,omitempty"`
+	Images       []jsonImage       `json:"images,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Canonical    string            `json:"canonical,omitempty"`
+	Assets       []string          `json:"assets,omitempty"`
+}
+
+// The JSON form of a heading
+type jsonHeading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// The JSON form of an image
+type jsonImage struct {
+	URL        string `json:"url"`
+	Descriptor string `json:"descriptor,omitempty"`
+}
+
+// The JSON form of a link
+type jsonLink struct {
+	URL  string `json:"url"`
+	Rel  string `json:"rel,omitempty"`
+	Type string `json:"type,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+// Convert the result for url to its JSON form
+func newJSONPage(url string, r *result) jsonPage {
+	p := jsonPage{Run: runID, Time: time.Now().UTC(), URL: url, Title: r.title, Status: r.status, Links: []jsonLink{},
+		Media: r.media, Old: r.old, Capped: r.capped, Truncated: r.truncated}
+	for _, l := range r.links {
+		p.Links = append(p.Links, jsonLink{l.url, l.rel, l.typ, l.text})
+	}
+	for _, h := range r.headings {
+		p.Headings = append(p.Headings, jsonHeading{h.level, h.text})
+	}
+	for _, i := range r.images {
+		p.Images = append(p.Images, jsonImage{i.url, i.descriptor})
+	}
+	if r.err != nil {
+		p.Error = r.err.Error()
+	}
+	p.TLSError = r.tlsError
+	p.Redirects = r.redirects
+	p.Size = r.size
+	p.Transferred = r.transferred
+	p.OpenGraph = r.openGraph
+	p.Twitter = r.twitter
+	p.MixedContent = r.mixedContent
+	p.Description = r.description
+	p.Canonical = r.canonical
+	p.Assets = r.assets
+
+	return p
+}
+
+// Convert the JSON form of a page back to a result
+func (p jsonPage) result() *result {
+	r := &result{title: p.Title, status: p.Status, old: p.Old, capped: p.Capped, truncated: p.Truncated, media: p.Media,
+		tlsError: p.TLSError, redirects: p.Redirects, size: p.Size, transferred: p.Transferred, openGraph: p.OpenGraph,
+		twitter: p.Twitter, mixedContent: p.MixedContent, description: p.Description, canonical: p.Canonical, assets: p.Assets}
+	for _, l := range p.Links {
+		r.links = append(r.links, link{l.URL, l.Rel, l.Type, l.Text})
+	}
+	for _, h := range p.Headings {
+		r.headings = append(r.headings, heading{h.Level, h.Text})
+	}
+	for _, i := range p.Images {
+		r.images = append(r.images, image{i.URL, i.Descriptor})
+	}
+	if p.Error != "" {
+		r.err = errors.New(p.Error)
+	}
+
+	return r
+}
+
+// A streamWriter writes every result to a file as one line of JSON as soon as it is fetched, so the results of very
+// large crawls do not have to fit in memory. The pages are sent over a channel to a single goroutine that writes them.
+// The lines are buffered, and written to the file when the buffer is full and every --flush-interval, so a large crawl
+// does not make a write call for every page, while the file still keeps up with the crawl.
+type streamWriter struct {
+	pages chan jsonPage
+	done  chan error
+	count int
+}
+
+// The writer for --stream-output, nil when results are kept in memory
+var stream *streamWriter
+
+// Create the file at path and start writing the pages that are sent to the stream into it.
+// With --stream-append, the pages are added to the end of an existing file instead.
+func newStreamWriter(path string) (*streamWriter, error) {
+	mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if *streamAppend {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(path, mode, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStream(file), nil
+}
+
+// Start writing the pages that are sent to the stream into file, which is closed with the stream
+func newStream(file io.WriteCloser) *streamWriter {
+	s := &streamWriter{make(chan jsonPage, 100), make(chan error, 1), 0}
+
+	go func() {
+		w := bufio.NewWriterSize(file, 64<<10)
+		enc := json.NewEncoder(w)
+
+		// a nil channel never fires, so without an interval we only flush when the buffer is full
+		var tick <-chan time.Time
+		if *flushInterval > 0 {
+			ticker := time.NewTicker(*flushInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		// keep reading after an error, so fetchers never block on the channel
+		var err error
+		for done := false; !done; {
+			select {
+			case p, ok := <-s.pages:
+				if !ok {
+					done = true
+					break
+				}
+				if err == nil {
+					err = enc.Encode(p)
+				}
+				s.count++
+			case <-tick:
+				if err == nil {
+					err = w.Flush()
+				}
+			}
+		}
+
+		if ferr := w.Flush(); err == nil {
+			err = ferr
+		}
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		s.done <- err
+	}()
+
+	return s
+}
+
+// Send the result for url to the file
+func (s *streamWriter) write(url string, r *result) {
+	s.pages <- newJSONPage(url, r)
+}
+
+// Write the remaining pages and close the file. The number of pages is only known after Close.
+func (s *streamWriter) Close() error {
+	close(s.pages)
+	return <-s.done
+}
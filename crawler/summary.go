@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// The number of URLs in the scope of the crawl that were found so far, crawled or not. They are counted when they
+// are added to the visited set, so the statistics do not keep a set of their own.
+var uniqueURLs atomic.Int64
+
+// A countingReader counts the bytes that are read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// The statistics of a crawl: the number of pages crawled, the unique URLs in its scope that were found (including
+// the ones that were not crawled, but not the links outside of the scope, which are counted by rule), the pages that could not be fetched, the URLs that robots.txt disallowed, the links that were
+// skipped by every scope rule (by the name of its option, e.g. --deny), the time it took, and the bytes read and
+// the (compressed) bytes transferred for them.
+// The pages are broken down by their response too: the ones that succeeded, the ones with a 4xx or 5xx status,
+// and the ones without a response at all, together with the number of hosts that we could not reach for them.
+type Stats struct {
+	Pages            int
+	URLs             int
+	Errors           int
+	Succeeded        int
+	ClientErrors     int
+	ServerErrors     int
+	Unreachable      int
+	UnreachableHosts int
+	Disallowed       int
+	Skipped          map[string]int
+	Elapsed          time.Duration
+	Bytes            int64
+	Transferred      int64
+}
+
+// A statsCollector is the pageReporter that adds up the statistics of the crawl while the pages come in
+type statsCollector struct {
+	stats       Stats
+	unreachable map[string]bool
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{unreachable: map[string]bool{}}
+}
+
+func (c *statsCollector) Page(url string, r *result) {
+	c.stats.Pages++
+	if r.err != nil {
+		c.stats.Errors++
+	}
+
+	// a page that broke off while it was read had a response, so it is only counted with the errors
+	switch {
+	case r.status >= 500:
+		c.stats.ServerErrors++
+	case r.status >= 400:
+		c.stats.ClientErrors++
+	case r.status == 0 && r.err != nil:
+		c.stats.Unreachable++
+		c.unreachable[hostOf(url)] = true
+	case r.err == nil:
+		c.stats.Succeeded++
+	}
+	c.stats.Bytes += r.size
+	c.stats.Transferred += r.transferred
+}
+
+func (c *statsCollector) Finish(Stats, map[string]int) error { return nil }
+
+// The statistics of the pages so far, for a crawl that took elapsed
+func (c *statsCollector) Stats(elapsed time.Duration) Stats {
+	s := c.stats
+	s.URLs = int(uniqueURLs.Load())
+	s.UnreachableHosts = len(c.unreachable)
+	s.Disallowed = int(robotsDisallowed.Load())
+
+	s.Skipped = map[string]int{}
+	scopeSkipped.Lock()
+	for rule, n := range scopeSkipped.counts {
+		s.Skipped[rule] = n
+	}
+	scopeSkipped.Unlock()
+	s.Elapsed = elapsed
+
+	return s
+}
+
+// Print the statistics to w
+func (s Stats) print(w io.Writer) {
+	fmt.Fprintln(w, "\n=== Summary")
+	fmt.Fprintf(w, "Pages crawled: %d\n", s.Pages)
+	fmt.Fprintf(w, "Unique URLs:   %d\n", s.URLs)
+	fmt.Fprintf(w, "Errors:        %d\n", s.Errors)
+	fmt.Fprintf(w, "Succeeded:     %d\n", s.Succeeded)
+	fmt.Fprintf(w, "Client errors: %d (4xx)\n", s.ClientErrors)
+	fmt.Fprintf(w, "Server errors: %d (5xx)\n", s.ServerErrors)
+	fmt.Fprintf(w, "Unreachable:   %d (on %d hosts)\n", s.Unreachable, s.UnreachableHosts)
+	if robotsRespected() {
+		fmt.Fprintf(w, "Disallowed:    %d (by robots.txt)\n", s.Disallowed)
+	}
+	if len(s.Skipped) > 0 {
+		fmt.Fprintf(w, "Out of scope:  %s\n", scopeSkippedSummary(s.Skipped))
+	}
+	fmt.Fprintf(w, "Elapsed:       %v\n", s.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "Bytes read:    %d\n", s.Bytes)
+	fmt.Fprintf(w, "Transferred:   %d\n", s.Transferred)
+}
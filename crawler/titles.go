@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The titles of the pages of an earlier crawl, read from the file of --compare-titles. Nil when we do not compare.
+var previousTitles map[string]string
+
+// A titleChange is a page whose title is different from the one it had in the earlier crawl
+type titleChange struct {
+	url      string
+	previous string
+	title    string
+}
+
+// The title changes found so far, which are recorded while the pages are stored
+var titleChanges struct {
+	sync.Mutex
+	changes []titleChange
+}
+
+// The form of a title that is used to compare titles, ignoring case and whitespace
+func titleKey(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// Read the titles from a file written by --stream-output. When the file has several runs (with --stream-append),
+// the last title of every page is used. Pages that could not be fetched, or were not modified, have no title.
+// When the file does not exist yet, there is nothing to compare with.
+func loadPreviousTitles(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	titles := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var p jsonPage
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			return nil, err
+		}
+		if p.Error == "" && !p.Old {
+			titles[p.URL] = p.Title
+		}
+	}
+
+	return titles, scanner.Err()
+}
+
+// Compare the title of a page that was just fetched with its title in the earlier crawl, and warn when it changed
+func checkTitle(url string, r *result) {
+	if previousTitles == nil || r.err != nil || r.old {
+		return
+	}
+
+	previous, ok := previousTitles[url]
+	if !ok || titleKey(previous) == titleKey(r.title) {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\nTitle of %s changed from %q to %q\n", url, previous, r.title)
+
+	titleChanges.Lock()
+	titleChanges.changes = append(titleChanges.changes, titleChange{url, previous, r.title})
+	titleChanges.Unlock()
+}
+
+// Print the pages whose title changed since the earlier crawl
+func printTitleChanges() {
+	titleChanges.Lock()
+	changes := append([]titleChange{}, titleChanges.changes...)
+	titleChanges.Unlock()
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].url < changes[j].url })
+
+	fmt.Fprintf(console, "\n=== Changed titles (%d)\n", len(changes))
+	for _, c := range changes {
+		fmt.Fprintf(console, "%v\n", c.url)
+		fmt.Fprintf(console, "|-- was: %v\n", c.previous)
+		fmt.Fprintf(console, "|-- now: %v\n", c.title)
+	}
+}
@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// Describe the certificate problem behind a fetch error, or return "" when the error is not about TLS
+func tlsProblem(err error) string {
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var verifyErr *tls.CertificateVerificationError
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+
+	switch {
+	case errors.As(err, &hostnameErr):
+		return hostnameErr.Error()
+	case errors.As(err, &authorityErr):
+		return "certificate signed by unknown authority"
+	case errors.As(err, &invalidErr):
+		if invalidErr.Reason == x509.Expired {
+			return "certificate has expired or is not yet valid"
+		}
+		return invalidErr.Error()
+	case errors.As(err, &verifyErr):
+		return verifyErr.Error()
+	case errors.As(err, &alertErr):
+		return "TLS handshake failed: " + alertErr.Error()
+	case errors.As(err, &recordErr):
+		return "server does not speak TLS"
+	}
+
+	return ""
+}
+
+// Print the hosts with certificate problems, with the problem and the number of URLs that ran into it
+func printTLSReport(f fetcher) {
+	type hostProblem struct {
+		problem string
+		urls    int
+	}
+	hosts := map[string]*hostProblem{}
+
+	for u, result := range f {
+		if result.tlsError == "" {
+			continue
+		}
+
+		host := u
+		if parsed, err := url.Parse(u); err == nil {
+			host = parsed.Host
+		}
+
+		if hosts[host] == nil {
+			hosts[host] = &hostProblem{problem: result.tlsError}
+		}
+		hosts[host].urls++
+	}
+
+	names := []string{}
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(console, "\n=== TLS problems (%d hosts)\n", len(names))
+	for _, host := range names {
+		fmt.Fprintf(console, "%v: %v (%d URLs)\n", host, hosts[host].problem, hosts[host].urls)
+	}
+}
@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// How many pages of every host have each title, to notice when the crawl wandered into a section that returns
+// the same page for every URL, like a login wall or a templated error page. Hosts in stopped are not crawled anymore.
+var hostTitles = struct {
+	sync.Mutex
+	counts  map[string]map[string]int
+	stopped map[string]bool
+}{counts: map[string]map[string]int{}, stopped: map[string]bool{}}
+
+// Count the title of a page that was just fetched, and warn when more than --duplicate-title-threshold pages
+// of its host have that title. With --duplicate-title-stop, the host is not crawled any further then.
+func countTitle(u string, r *result) {
+	if *duplicateTitleThreshold <= 0 || r.err != nil || r.old || strings.TrimSpace(r.title) == "" {
+		return
+	}
+
+	host := hostOf(u)
+	title := titleKey(r.title)
+
+	hostTitles.Lock()
+	defer hostTitles.Unlock()
+
+	if hostTitles.counts[host] == nil {
+		hostTitles.counts[host] = map[string]int{}
+	}
+	hostTitles.counts[host][title]++
+
+	// only warn once, when the threshold is passed
+	if hostTitles.counts[host][title] != *duplicateTitleThreshold+1 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\nMore than %d pages on %s have the title %q, the crawl may be stuck in a trap\n",
+		*duplicateTitleThreshold, host, r.title)
+	if *duplicateTitleStop {
+		hostTitles.stopped[host] = true
+		fmt.Fprintf(os.Stderr, "Stopped crawling %s\n", host)
+	}
+}
+
+// Whether the host of the URL is not crawled anymore because of --duplicate-title-stop
+func hostStopped(u string) bool {
+	hostTitles.Lock()
+	defer hostTitles.Unlock()
+
+	return hostTitles.stopped[hostOf(u)]
+}
+
+// The host of a URL, lowercased, or the URL itself when it cannot be parsed
+func hostOf(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+
+	return strings.ToLower(parsed.Host)
+}
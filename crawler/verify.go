@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Read the URLs to verify from a file, one per line. Empty lines and lines starting with # are skipped.
+func readURLList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	urls := []string{}
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+
+	return urls, s.Err()
+}
+
+// Fetch every URL in the list at path, without following any links, and write to w whether it resolves to a 2xx page.
+// It returns the number of URLs that are missing or broken.
+func verifyList(w io.Writer, path string) (int, error) {
+	urls, err := readURLList(path)
+	if err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for _, u := range urls {
+		status, err := verifyURL(u)
+
+		switch {
+		case err != nil:
+			failed++
+			fmt.Fprintf(w, "FAIL %v (%v)\n", u, err)
+		case status < 200 || status > 299:
+			failed++
+			fmt.Fprintf(w, "FAIL %v (%d)\n", u, status)
+		default:
+			fmt.Fprintf(w, "OK   %v (%d)\n", u, status)
+		}
+	}
+
+	fmt.Fprintf(w, "\nVerified %d URLs, %d failed\n", len(urls), failed)
+
+	return failed, nil
+}
+
+// Fetch a URL and return its status code after following redirects
+func verifyURL(url string) (int, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drain a bit of the body so the connection can be reused for the next URL
+	io.Copy(io.Discard, io.LimitReader(resp.Body, *maxBodySize))
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"hash/maphash"
+	"math"
+)
+
+// A visitedSet remembers the URLs the crawler has seen, so it crawls every URL only once
+type visitedSet interface {
+	// Add marks url as seen at the given depth, and returns false if it was seen before
+	Add(url string, depth int) bool
+}
+
+// An exactSet is the default visited set. It maps every URL seen to the depth at which it was found.
+type exactSet map[string]int
+
+func (s exactSet) Add(url string, depth int) bool {
+	if _, ok := s[url]; ok {
+		return false
+	}
+
+	s[url] = depth
+	return true
+}
+
+// A bloomSet is a visited set for huge crawls (--approx-dedup) that uses a fixed amount of memory: a Bloom filter of
+// about 1.44*log2(1/p) bits per URL for a false positive rate p, so 2 bytes per URL for p=0.001, while an exact set
+// stores every URL in full. The catch is that a false positive makes the crawler think a new URL was already seen,
+// so now and then a page is skipped. It does not remember depths either.
+type bloomSet struct {
+	bits  []uint64
+	m     uint64
+	k     int
+	seeds [2]maphash.Seed
+}
+
+// The number of URLs to size the Bloom filter of --approx-dedup for. Every URL that is found is added to it, not only
+// the max_urls that are crawled, so by default it counts on 20 new URLs per page.
+func bloomCapacity() int {
+	if *approxDedupCapacity > 0 {
+		return *approxDedupCapacity
+	}
+	return max(20**maxURLS, 1000)
+}
+
+// Create a Bloom filter for n URLs with a false positive rate of p. With more URLs the rate goes up.
+func newBloomSet(n int, p float64) *bloomSet {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &bloomSet{make([]uint64, (m+63)/64), m, k, [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()}}
+}
+
+func (b *bloomSet) Add(url string, _ int) bool {
+	// derive the k bit positions from two independent hashes (Kirsch and Mitzenmacher), with their own seeds. The
+	// second one is odd, so it does not share a factor with a power of two m
+	h1 := maphash.String(b.seeds[0], url)
+	h2 := maphash.String(b.seeds[1], url) | 1
+
+	added := false
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			b.bits[bit/64] |= 1 << (bit % 64)
+			added = true
+		}
+	}
+
+	return added
+}
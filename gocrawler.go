@@ -12,232 +12,164 @@ package main
  * <depth>    Recursive depth of the crawling (default=3)
  * <max_urls> Maximum number of urls to crawl for (default=150)
  *
+ * Optional flags:
+ *
+ * --config=<file>              JSON config file with per host settings, see crawler/config.go
+ * --verify-list=<file>         Only fetch the URLs in the file (one per line) and report which ones are missing or broken,
+ *                              exiting with status 1 if any are
+ * --check-links                Also check the links to pages that are not crawled, like other sites, with a HEAD request,
+ *                              and report the broken links by the page they are on, exiting with status 1 if there are any
+ * --stream-output=<file>       Write every page to the file as a line of JSON as soon as it is crawled, instead of
+ *                              keeping the results in memory
+ * --flush-interval=<duration>  How often to write the buffered pages to the --stream-output file (default=1s, 0 means
+ *                              only when 64 KB of pages are buffered)
+ * --stream-append              Append to the --stream-output file instead of overwriting it (the other outputs are
+ *                              always overwritten)
+ * --approx-dedup               Remember the visited URLs in a Bloom filter, which uses about 2 bytes per URL but
+ *                              skips a page now and then (see crawler/visited.go)
+ * --approx-dedup-rate=<p>      False positive rate of the Bloom filter (default=0.001)
+ * --approx-dedup-capacity=<n>  Number of URLs found that the Bloom filter is sized for (default=0, 20 times max_urls)
+ * --seen-db=<file>             Skip the URLs crawled by earlier runs with the same file, and add the ones crawled now
+ * --state-dir=<dir>            Save the state of the crawl in <dir>/<crawl-id>, and resume the crawl from there
+ *                              if it was interrupted (see crawler/state.go)
+ * --crawl-id=<id>              Name of the crawl in the state directory (default=default)
+ * --state=<dir>                Save the state of the crawl in <dir>, so it can be continued with --resume
+ * --resume                     Continue the crawl saved with --state (or --state-dir) instead of starting over
+ * --state-interval=<duration>  How often to save the state of the crawl (default=10s)
+ * --output=urls                Only print the URLs of the pages that were crawled without an error, one per line
+ * --sort-urls                  Sort the URLs printed with --output=urls
+ * --quiet                      Do not print the progress of the crawl, only its results
+ * --progress=<duration>        Print the statistics of the crawl this often instead of a dot per URL found: pages
+ *                              crawled, queued and failed, pages per second, bytes read and pages per depth
+ * --metrics-addr=<addr>        Serve the statistics of the running crawl on this address (e.g. :8080), at /metrics
+ *                              in the Prometheus text format and at /metrics.json as JSON
+ * --output=sqlite --db=<path>  Write the crawled pages and links to a SQLite database instead of printing them
+ * --output=graphml --graphml=<path>
+ *                              Write the link graph to a GraphML file (for e.g. Gephi) instead of printing it
+ * --output=adjacency --adjacency=<path>
+ *                              Write the link graph as a JSON adjacency list (for e.g. NetworkX) instead of printing
+ *                              it, with only the links in the scope of the crawl
+ * --graph=<file>               Also write the link graph of the crawl to the file, with the depth of every link and
+ *                              whether it stays on the host of the start URL
+ * --graph-format=<format>      Format of the --graph file: dot (Graphviz), graphml (e.g. Gephi) or jsonl (default=dot)
+ * --sitemap=<urls>             Also crawl the pages in these comma separated sitemaps (sitemap indexes, .gz sitemaps
+ *                              and RSS/Atom feeds too) at depth 1, counting towards max_urls
+ * --robots-sitemaps            Also crawl the pages in the sitemaps listed by the Sitemap: lines of the robots.txt of
+ *                              the host of the start URL
+ * --use-sitemap                Find the sitemaps of the start URL (in robots.txt, or else /sitemap.xml) and the feeds
+ *                              its page links to, and crawl their pages at depth 1, as if the start URL linked to them
+ * --max_concurrency=<n>        Fetch at most n pages at the same time (default=20)
+ * --concurrency=<n>            Same as --max_concurrency: the number of workers that fetch pages
+ * --max-per-host=<n>           Fetch at most n pages of one host at the same time (default=0, no limit)
+ * --delay=<duration>           Start the requests to one host at least this far apart, e.g. 500ms (default=0)
+ * --max-path-depth=<n>         Do not crawl URLs with more than n path segments, e.g. /a/b/c has 3 (default=0, no limit)
+ * --max-per-level=<n>          Crawl at most n URLs at every depth, the ones with the highest Score (default=0, no limit)
+ * --timeout=<duration>         Maximal time to fetch a page, including reading its body (default=10s)
+ * --max-duration=<duration>    Stop the crawl after this time, and write the pages crawled so far (default=0, no limit).
+ *                              Ctrl-C stops it in the same way, a second Ctrl-C quits at once
+ * --max-pagination=<n>         Follow at most n rel="next" links in a row (default=0, no limit)
+ * --title-max-len=<n>          Truncate titles longer than n characters with an ellipsis (default=0, no limit)
+ * --user_agent=<agent>         User-Agent header to send with every request (default=gocrawler)
+ * --respect_robots=false       Also crawl the URLs that the robots.txt of their host disallows for --user_agent, and
+ *                              do not wait for its Crawl-delay
+ * --ignore-robots              Same as --respect_robots=false
+ * --http1                      Only use HTTP/1.1 (no HTTP/2) and ask servers to close the connection after every request
+ * --force-close                Close the connection after every request, also over HTTP/2
+ * --client-cert=<file> --client-key=<file>
+ *                              Authenticate with this client certificate to servers that require mutual TLS
+ * --client-cert-hosts=<hosts>  Comma separated hosts to present the client certificate to, *.example.com for every host
+ *                              under it (default=the host of the start URL)
+ * --header="<name>: <value>"
+ *                              Send this header to the host of the start URL, e.g. an Authorization header (can be
+ *                              given more than once)
+ * --cookies                    Keep the cookies that servers set and send them back, like a browser does
+ * --cookie="<n>=<v>; <n2>=<v2>"
+ *                              Send these cookies to the host of the start URL, e.g. a session cookie (implies
+ *                              --cookies)
+ * --proxy=<url>                Send every request through this proxy, http://, https:// or socks5:// (default=from the
+ *                              environment, HTTP_PROXY etc)
+ * --insecure                   Do not verify TLS certificates, e.g. for a test server with a self-signed certificate
+ * --retries=<n>                Fetch a page again, up to n times, when it times out or is reset, the server answers
+ *                              with a 5xx status or the connection breaks while it is read (default=2)
+ * --max-body-size=<bytes>      Maximal number of bytes to read from a page (default=10485760)
+ * --parsers=<names>            Also find the links in pages that are not HTML, with these comma separated parsers:
+ *                              css, json and text (default=none, other pages are not read)
+ * --content-selector=<selector>
+ *                              Only take links from inside the element matching the selector, which is a tag,
+ *                              tag#id or tag.class (e.g. main, div#content, div.post)
+ * --extract-media              Record the URLs of the audio and video on every page, without crawling them
+ * --anchor-text-match=<regexp> Only follow links whose text matches the regular expression, other links are
+ *                              still recorded
+ * --extract-images             Record the URLs of the images on every page, with every srcset candidate and its
+ *                              descriptor (e.g. 2x or 640w), without crawling them
+ * --extract-headings           Record the outline of h1-h6 headings of every page
+ * --extract=<extractors>       Comma separated extractors for more of every page: meta (description and canonical
+ *                              URL), assets (scripts, stylesheets and images), headings, images and media
+ * --respect-nofollow           Record links with rel=nofollow, but do not follow them
+ * --same_host                  Only follow links to the host of the start URL. www.example.com and example.com are the
+ *                              same host, but other subdomains like blog.example.com are not
+ * --include-subdomains         With --same_host, also follow links to the hosts under it, like blog.example.com
+ * --same-domain                Only follow links to the registrable domain of the start URL, like example.co.uk for
+ *                              www.example.co.uk, and all hosts under it
+ * --allow=<regexp>             Only follow links whose URL matches the regular expression
+ * --deny=<regexp>              Do not follow links whose URL matches the regular expression
+ * --same-directory             Only follow links in the directory of the page they are on, or below it
+ * --parse-css                  Also crawl the pages referred to by url(...) and @import in linked stylesheets
+ * --since=<date>               Only crawl pages modified after the date (2006-01-02 or RFC 3339), older pages are
+ *                              recorded but their links are not followed
+ * --fail-fast-on-seed=false    Do not check that the start URL is a reachable HTML page before crawling
+ * --normalize-unicode          Treat Unicode and punycode forms of internationalized host names as the same host
+ * --normalize-default-documents
+ *                              Treat /dir/index.html as /dir/, for every file name in --default-documents
+ * --default-documents=<names>  Comma separated file names that servers show for a directory
+ *                              (default=index.html,index.htm,index.php,default.aspx,default.asp,default.htm)
+ * --normalize-trailing-slash=false
+ *                              Treat /dir/ and /dir as different pages (by default the trailing slash is removed)
+ * --on-page=<command>          Run the shell command for every page, with the URL as $1 and the body of the page on stdin
+ * --on-page-concurrency=<n>    Maximal number of --on-page commands running at the same time (default=4)
+ * --on-page-abort              Stop the crawl, and exit with status 1, when an --on-page command fails
+ * --format=json|csv|sitemap    Print the crawl as one JSON document or as CSV, with the title, status, depth, parent
+ *                              and URLs of every page, or as a sitemap of the pages that were found, and print
+ *                              everything else (like the progress dots) to stderr so stdout can be piped into jq
+ * --output-file=<file>         Write the crawl to the file instead of stdout
+ * --summary-only               Only print the statistics of the crawl (pages, unique URLs, errors, time and bytes read),
+ *                              without the list of crawled URLs
+ * --group-by-status            Print the crawled URLs grouped by status class: 2xx, 3xx, 4xx, 5xx and errors
+ * --duplicate-titles           Report titles that are shared by more than one page
+ * --report-frontier            Report the URLs that were found but not crawled because of --depth, --max_urls or
+ *                              --max-per-level
+ * --compare-titles=<file>      Warn about the pages whose title changed since the earlier crawl written to the file by
+ *                              --stream-output, and report them after the crawl
+ * --duplicate-title-threshold=<k>
+ *                              Warn when more than k pages of a host have the same title, which may be a crawl trap
+ *                              like a login wall or a templated error page
+ * --duplicate-title-stop       Stop crawling a host when it passes --duplicate-title-threshold
+ * --report-selflinks           Report the pages that link to themselves, which may be a bug in their template
+ * --report-mixed-content       Report the HTTPS pages that load images, scripts, stylesheets etc. over http://
+ * --report-tls                 Report the hosts with invalid, expired or untrusted TLS certificates
+ * --max-redirect-report=<n>    Report the URLs that go through more than n redirects, with their redirect chains
+ * --min-compression-ratio=<r>  Report the pages whose compression ratio (page size / bytes transferred) is below r
+ * --strip-tracking-params      Treat URLs that only differ in tracking query parameters, like utm_source, fbclid and
+ *                              gclid, as the same page
+ * --allow-query-params-only-for-hosts=<rules>
+ *                              Only treat query parameters as significant on these comma separated hosts or host/path
+ *                              prefixes (e.g. search.example.com,example.com/search); elsewhere they are dropped
+ *
  * Extension of the last "A Tour of Go" exercise: https://tour.golang.org/concurrency/9
  * HTML parsing techniques from: http://schier.co/blog/2015/04/26/a-simple-web-scraper-in-go.html
  *
- * - Skips over filenames such as PDF, ZIP etc.
+ * - Skips over filenames such as PDF, ZIP etc., and does not read pages whose Content-Type it has no parser for
  * - Shows titles of URLs
  * - User can choose maximum depth and maximum number of websites to crawl
  */
 
 import (
-	"flag"
-	"fmt"
-	"golang.org/x/net/html"
-	"net/http"
-	"strings"
-)
-
-var startURL = flag.String("url", "http://www.marcvanzee.nl", "The URL to start crawling from")
-var depth = flag.Int("depth", 2, "Depth of the search")
-var maxURLS = flag.Int("max_urls", 150, "Maximal number of URLs to crawl")
-
-var countCrawled = 0
-
-// A Fetcher visit the input url and returns the urls that occur on that website
-// It returns an error when it cannot read the url
-type Fetcher interface {
-	Fetch(url string) (urls []string, err error)
-}
-
-// The crawhistory consists of an embed Fetcher (https://soniacodes.wordpress.com/2011/10/09/a-tour-of-go-69-exercise-web-crawler/)
-// And an access token for the history map
-type crawlHistory struct {
-	Fetcher
-	mapAccess chan map[string]bool
-}
-
-// The crawl function that is called by main
-func Crawl(url string, depth int, fetcher Fetcher) {
-
-	// define the crawlhistory
-	c := &crawlHistory{
-		fetcher,
-		make(chan map[string]bool, 1),
-	}
-
-	// the first crawler has access to the map in the crawhistory
-	c.mapAccess <- map[string]bool{url: true}
-
-	// use the done token to ensure we do not exit the program early
-	done := make(chan bool, 1)
-
-	c.Crawl(url, depth, done)
+	"os"
 
-	// exit when the crawler has finished
-	<-done
-}
-
-// The crawl function that is called by the original crawler
-func (c *crawlHistory) Crawl(url string, depth int, done chan bool) {
-	// when we are done, add the token and return so we can quit
-	if depth <= 0 {
-		done <- true
-		return
-	}
-
-	urls, err := c.Fetch(url)
-
-	// we don't care about error messages
-	// simply ignore website that we cannot visit
-	if err != nil {
-		done <- true
-		return
-	}
-
-	// count the urls we visit so we can wait for them to finish crawling before exiting
-	count := 0
-	doneHere := make(chan bool)
-
-	// request access to the history map
-	m := <-c.mapAccess
-
-	// iterate over all urls that were in the body of the input url
-	for _, u := range urls {
-		if !m[u] {
-			m[u] = true
-			count++
-			go c.Crawl(u, depth-1, doneHere)
-		}
-	}
-
-	// free the access token for the history map
-	c.mapAccess <- m
-
-	// wait for all crawlers to finish
-	for ; count > 0; count-- {
-		<-doneHere
-	}
-
-	done <- true
-}
+	"github.com/marcvanzee/gocrawler/crawler"
+)
 
+// The command line tool is a thin wrapper around the crawler package, which can also be used as a library
 func main() {
-	flag.Parse()
-	fmt.Println("====== Starting crawling...")
-	fmt.Println("=== Start URL: ", *startURL)
-	fmt.Println("=== Depth:     ", *depth)
-	fmt.Println("=== Max URLS:  ", *maxURLS)
-	fmt.Println("=== Progress (1 dot is 1 URL found): ")
-
-	f := fetcher(make(map[string]*result, 10))
-	Crawl(*startURL, *depth, f)
-
-	fmt.Println("\n==== Finished crawling!")
-
-	fmt.Print("Start URL:", *startURL)
-	if val, ok := f[*startURL]; ok {
-		fmt.Printf("(%s)", val.title)
-	}
-	fmt.Println()
-
-	i := 0
-	for url, result := range f {
-		fmt.Printf("%v (%v)\n", url, result.title)
-		for _, url2 := range result.urls {
-			i++
-			fmt.Printf("|-- %v\n", url2)
-		}
-	}
-
-	fmt.Printf("\nCrawled %d websites, found %d unique URLs\n", len(f), i)
-}
-
-// A fetcher is a mapping from a URL to the relevant content that we have crawled
-type fetcher map[string]*result
-
-// The result stores the relevant content of a URL, which is its title and all URLs that occur in the body
-type result struct {
-	title string
-	urls  []string
-}
-
-// A fetcher implements fetching, which performs the crawling for an input URL and returns the URLs found in the body
-func (f fetcher) Fetch(url string) ([]string, error) {
-	resp, err := http.Get(url)
-
-	if err != nil {
-		return nil, fmt.Errorf("error")
-	}
-
-	title := ""
-	urls := []string{}
-
-	b := resp.Body
-
-	defer b.Close()
-
-	// code for HTML parsing
-	// from: http://schier.co/blog/2015/04/26/a-simple-web-scraper-in-go.html
-	// only I added the parsing of the title of the URL
-	z := html.NewTokenizer(b)
-
-	done := false
-	for !done {
-		tt := z.Next()
-
-		switch tt {
-		case html.ErrorToken:
-			done = true
-			break
-		case html.StartTagToken:
-			t := z.Token()
-
-			switch t.Data {
-			case "a":
-				ok, u := getHref(t)
-				if !ok {
-					continue
-				}
-
-				if strings.Index(u, "http") == 0 {
-					if countCrawled > *maxURLS {
-						f[url] = &result{title, urls}
-						return nil, fmt.Errorf("error")
-					}
-					fmt.Print(".")
-
-					if !isFile(u) {
-						urls = append(urls, u)
-						countCrawled++
-					}
-				}
-			case "title":
-				if ttt := z.Next(); ttt == html.TextToken {
-					title = z.Token().String()
-				}
-			}
-		}
-	}
-
-	// store the result in the fetcher
-	f[url] = &result{title, urls}
-
-	return urls, nil
-}
-
-// retrieve the URL from a <a href="..."> token.
-// from http://schier.co/blog/2015/04/26/a-simple-web-scraper-in-go.html
-func getHref(t html.Token) (ok bool, href string) {
-	for _, a := range t.Attr {
-		if a.Key == "href" {
-			href = a.Val
-			ok = true
-		}
-	}
-
-	return
-}
-
-func isFile(url string) bool {
-	files := []string{".pdf", ".zip", ".jpeg", ".jpg", ".gif", ".png", ".doc", ".docx", ".rar", ".gzip", ".tar", ".mp3",
-		".wav", ".mpg", ".mpeg", ".swf", ".exe", ".bin"}
-
-	for _, file := range files {
-		if strings.HasSuffix(url, file) {
-			return true
-		}
-	}
-
-	return false
+	crawler.Main(os.Args[1:])
 }